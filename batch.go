@@ -0,0 +1,47 @@
+package jobq
+
+import (
+	"database/sql"
+)
+
+// QueueBatch pushes tasks to task queue using as few statements as
+// possible. COPY is used if e is *sql.Tx and tasks have no unique keys,
+// otherwise tasks are inserted with multi-row insert statements.
+// Workers are notified once per job and queue instead of once per task.
+// Tasks with unique keys that already exist are skipped and their uids
+// are replaced with uids of existing tasks. If e is not a DBQueryer,
+// existing tasks can't be looked up and error wrapping ErrDuplicateTask
+// is returned instead
+func QueueBatch(e DBExecer, tasks ...*PreparedTask) error {
+	rows := make([]*TaskRow, 0, len(tasks))
+	unique := false
+	for _, task := range tasks {
+		if err := validatePreparedTask(task); err != nil {
+			return err
+		}
+		row, err := task.row()
+		if err != nil {
+			return err
+		}
+		unique = unique || row.uniqueKey.Valid
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if tx, ok := e.(*sql.Tx); ok && !unique {
+		return copyTasks(tx, rows)
+	}
+	if err := queueTasks(e, rows); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		task := tasks[i]
+		// uid is replaced with uid of existing task with the same unique key
+		if row.uid == task.uid && task.options.metrics != nil {
+			task.options.metrics.TaskEnqueued(task.jobName, 1)
+		}
+		task.uid = row.uid
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package jobq
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueueBatch(t *testing.T) {
+	body := mockValuer{
+		onValue: func() ([]byte, error) {
+			return []byte(`{}`), nil
+		},
+	}
+	first, _ := NewTask("send_email", body, WithTaskUID("first"))
+	second, _ := NewTask("send_email", body, WithTaskUID("second"), WithTaskPriority(5))
+	execer := &mockDBExecer{}
+	if err := QueueBatch(execer, first, second); err != nil {
+		t.Fatalf("QueueBatch() error = %v", err)
+	}
+	wantStmt := "INSERT INTO jobq_tasks (uid, job_name, body, retries, timeout, start_at, " +
+		"retry_policy, ttl, headers, priority, queue, unique_key) VALUES " +
+		"($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12), " +
+		"($13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24);"
+	if execer.gotStmt != wantStmt {
+		t.Errorf("QueueBatch() stmt = %v, want %v", execer.gotStmt, wantStmt)
+	}
+	if len(execer.gotArgs) != 24 || execer.gotArgs[0] != "first" || execer.gotArgs[12] != "second" || execer.gotArgs[21] != 5 {
+		t.Errorf("QueueBatch() args = %v", execer.gotArgs)
+	}
+	if err := QueueBatch(execer, first, nil); err != ErrInvalidPreparedTask {
+		t.Errorf("QueueBatch() error = %v, want %v", err, ErrInvalidPreparedTask)
+	}
+}
+
+func TestQueueBatch_metrics(t *testing.T) {
+	body := mockValuer{
+		onValue: func() ([]byte, error) {
+			return []byte(`{}`), nil
+		},
+	}
+	metrics := new(mockMetrics)
+	first, _ := NewTask("send_email", body, WithTaskMetrics(metrics))
+	second, _ := NewTask("send_email", body, WithTaskMetrics(metrics))
+	third, _ := NewTask("send_email", body)
+	if err := QueueBatch(&mockDBExecer{}, first, second, third); err != nil {
+		t.Fatalf("QueueBatch() error = %v", err)
+	}
+	if want := []string{"enqueued", "enqueued"}; !reflect.DeepEqual(metrics.calls, want) {
+		t.Errorf("QueueBatch() metrics = %v, want %v", metrics.calls, want)
+	}
+	if err := QueueBatch(&mockDBExecer{wantErr: true}, first); err == nil {
+		t.Errorf("QueueBatch() error = nil, want error")
+	}
+	if want := []string{"enqueued", "enqueued"}; !reflect.DeepEqual(metrics.calls, want) {
+		t.Errorf("QueueBatch() metrics after error = %v, want %v", metrics.calls, want)
+	}
+}
+
+func Test_queueTasks(t *testing.T) {
+	rows := make([]*TaskRow, maxBatchRows+1)
+	for i := range rows {
+		rows[i] = &TaskRow{}
+	}
+	rows[maxBatchRows].uniqueKey.Valid = true
+	execer := &mockDBExecer{affected: 1}
+	if err := queueTasks(execer, rows); err != nil {
+		t.Fatalf("queueTasks() error = %v", err)
+	}
+	// last statement contains the last row only
+	if len(execer.gotArgs) != len(taskColumns) {
+		t.Errorf("queueTasks() last statement args = %v, want %v", len(execer.gotArgs), len(taskColumns))
+	}
+	if !strings.HasSuffix(execer.gotStmt, "ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING RETURNING uid;") {
+		t.Errorf("queueTasks() last stmt = %v, want ON CONFLICT DO NOTHING", execer.gotStmt)
+	}
+	// skipped task can't be looked up without DBQueryer
+	execer.affected = 0
+	if err := queueTasks(execer, rows[maxBatchRows:]); !errors.Is(err, ErrDuplicateTask) {
+		t.Errorf("queueTasks() error = %v, want %v", err, ErrDuplicateTask)
+	}
+	// inserted uids are queried with DBQueryer
+	tx := &mockTx{
+		mockDBExecer:  &mockDBExecer{},
+		mockDBQueryer: &mockDBQueryer{wantErr: true},
+	}
+	if err := queueTasks(tx, rows[maxBatchRows:]); err == nil {
+		t.Errorf("queueTasks() error = nil, want query error")
+	}
+	if !strings.HasSuffix(tx.mockDBQueryer.gotStmt, "RETURNING uid;") {
+		t.Errorf("queueTasks() query = %v, want RETURNING uid", tx.mockDBQueryer.gotStmt)
+	}
+}
+
+func Test_copyArgs(t *testing.T) {
+	args, err := copyArgs([]interface{}{
+		[]byte(`{"a":1}`),
+		taskHeaders{"b": "2"},
+		nullTime{},
+		5,
+	})
+	if err != nil {
+		t.Fatalf("copyArgs() error = %v", err)
+	}
+	if args[0] != `{"a":1}` || args[1] != `{"b":"2"}` || args[2] != nil || args[3] != 5 {
+		t.Errorf("copyArgs() = %v", args)
+	}
+}
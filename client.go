@@ -0,0 +1,235 @@
+package jobq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ClientOptions contains all client options
+type ClientOptions struct {
+	conninfo string
+}
+
+var defaultClientOptions = ClientOptions{}
+
+func (opts ClientOptions) with(args ...ClientOption) ClientOptions {
+	for _, opt := range args {
+		opt(&opts)
+	}
+	return opts
+}
+
+// ClientOption configures client
+type ClientOption func(*ClientOptions)
+
+// WithClientResultNotifications makes Client.Result wake up on task
+// completion notifications of a listener connected with conninfo.
+// Results are still polled, but every 5 seconds instead of every second
+func WithClientResultNotifications(conninfo string) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.conninfo = conninfo
+	}
+}
+
+// Client looks up tasks queued by producers
+type Client struct {
+	store    managerStore
+	options  ClientOptions
+	listener *pq.Listener
+	waiters  map[string]map[chan struct{}]struct{}
+	mu       sync.Mutex
+}
+
+// NewClient creates a new Client that uses db for queries
+func NewClient(db DB, opts ...ClientOption) *Client {
+	return &Client{
+		store:   &store{db: db},
+		options: defaultClientOptions.with(opts...),
+		waiters: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Close closes completion listener of the client
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.listener == nil {
+		return nil
+	}
+	err := c.listener.Close()
+	c.listener = nil
+	return err
+}
+
+// TaskStatus returns state and last reported progress of a task by
+// it's uid. Finished tasks that never reported progress can not
+// be told apart from unknown ones and return ErrTaskNotFound
+func (c *Client) TaskStatus(uid string) (*TaskStatus, error) {
+	return c.store.TaskStatus(uid)
+}
+
+// History returns history entries of a task by it's uid, oldest first.
+// Finished tasks are kept only by managers with WithManagerHistory,
+// canceled tasks are always kept
+func (c *Client) History(uid string) ([]*HistoryEntry, error) {
+	return c.store.TaskHistory(uid)
+}
+
+// cancelPollInterval is how often acknowledgement of cancel is checked
+const cancelPollInterval = time.Millisecond * 100
+
+// Cancel cancels a task by it's uid. Queued task is deleted right away.
+// Cancel of a claimed task is recorded and Cancel waits until a worker
+// acknowledges it. Running task is canceled by it's worker, which cancels
+// context passed to HandleTask and drops the task instead of retrying it.
+// Tasks of batch jobs share context, so canceled task of a batch is
+// dropped after the batch is handled. Canceled tasks are kept in task
+// history. ErrCancelPending is returned if ctx is done before cancel is
+// acknowledged; recorded cancel is still applied when task is started
+// or it's lease is reaped. ErrTaskNotFound is returned for unknown
+// tasks and for tasks that finished before they were canceled
+func (c *Client) Cancel(ctx context.Context, uid string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := c.store.Cancel(uid)
+	for err == ErrCancelPending {
+		select {
+		case <-ctx.Done():
+			return ErrCancelPending
+		case <-time.After(cancelPollInterval):
+		}
+		var pending bool
+		pending, err = c.store.CancelPending(uid)
+		if err == nil && pending {
+			err = ErrCancelPending
+		}
+	}
+	return err
+}
+
+// Result waits until task of a result job finishes and scans it's
+// result. Result is polled every second, unless client is created
+// with WithClientResultNotifications. ErrTaskDead is returned if task
+// was moved to dead tasks, ErrTaskCanceled is returned if task was
+// canceled, ErrTaskNotFound is returned if task is neither queued nor
+// running and has no result, and ctx error is returned if ctx is done
+// before task finishes
+func (c *Client) Result(ctx context.Context, uid string, result Scanner) error {
+	if err := validateTaskBodyScanner(result); err != nil {
+		return err
+	}
+	finished, unsubscribe, err := c.subscribe(uid)
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+	for {
+		// status is checked before result, since
+		// result is stored when task leaves the queue
+		status, err := c.store.TaskStatus(uid)
+		if err != nil && err != ErrTaskNotFound {
+			return err
+		}
+		body, err := c.store.TaskResult(uid)
+		if err == nil {
+			return result.Scan(body)
+		}
+		if err != ErrTaskNotFound {
+			return err
+		}
+		dead, err := c.store.DeadTask(uid)
+		if err == nil {
+			return fmt.Errorf("%w: %s", ErrTaskDead, dead.LastError())
+		}
+		if err != ErrTaskNotFound {
+			return err
+		}
+		if status != nil && status.State() == TaskCanceled {
+			return ErrTaskCanceled
+		}
+		if status == nil || (status.State() != TaskQueued && status.State() != TaskRunning) {
+			return ErrTaskNotFound
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-finished:
+		case <-time.After(c.pollInterval()):
+		}
+	}
+}
+
+// pollInterval returns how often results are checked. Results
+// are checked less often when completion is notified by listener
+func (c *Client) pollInterval() time.Duration {
+	if c.options.conninfo == "" {
+		return time.Second
+	}
+	return time.Second * 5
+}
+
+// subscribe returns channel that receives completion of a task.
+// Nil channel is returned if client has no listener
+func (c *Client) subscribe(uid string) (<-chan struct{}, func(), error) {
+	if c.options.conninfo == "" {
+		return nil, func() {}, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.listen(); err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan struct{}, 1)
+	if c.waiters[uid] == nil {
+		c.waiters[uid] = make(map[chan struct{}]struct{})
+	}
+	c.waiters[uid][ch] = struct{}{}
+	return ch, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.waiters[uid], ch)
+		if len(c.waiters[uid]) == 0 {
+			delete(c.waiters, uid)
+		}
+	}, nil
+}
+
+// listen starts completion listener once
+func (c *Client) listen() error {
+	if c.listener != nil {
+		return nil
+	}
+	l := pq.NewListener(c.options.conninfo, 10*time.Second, time.Minute, nil)
+	if err := l.Listen("jobq_task_finished"); err != nil {
+		l.Close()
+		return err
+	}
+	c.listener = l
+	go c.receive(l)
+	return nil
+}
+
+// receive notifies waiters of finished tasks. All waiters are
+// notified after reconnect, since notifications could be missed
+func (c *Client) receive(l *pq.Listener) {
+	for n := range l.Notify {
+		c.mu.Lock()
+		for uid, chs := range c.waiters {
+			if n != nil && n.Extra != uid {
+				continue
+			}
+			for ch := range chs {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+		c.mu.Unlock()
+	}
+}
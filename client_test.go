@@ -0,0 +1,176 @@
+package jobq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockResult struct {
+	body []byte
+}
+
+func (r *mockResult) Scan(val []byte) error {
+	r.body = val
+	return nil
+}
+
+func TestClient_Result(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  [][]byte
+		dead     bool
+		state    TaskState
+		unknown  bool
+		timeout  time.Duration
+		wantBody string
+		wantErr  error
+	}{
+		{
+			name:     "finished",
+			results:  [][]byte{[]byte(`{"rows":42}`)},
+			wantBody: `{"rows":42}`,
+		},
+		{
+			name:     "finished_after_poll",
+			results:  [][]byte{nil, []byte(`{"rows":42}`)},
+			wantBody: `{"rows":42}`,
+		},
+		{
+			name:    "dead",
+			dead:    true,
+			wantErr: ErrTaskDead,
+		},
+		{
+			name:    "timeout",
+			timeout: time.Millisecond * 10,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "canceled",
+			state:   TaskCanceled,
+			wantErr: ErrTaskCanceled,
+		},
+		{
+			name:    "finished_without_result",
+			state:   TaskFinished,
+			wantErr: ErrTaskNotFound,
+		},
+		{
+			name:    "unknown",
+			unknown: true,
+			wantErr: ErrTaskNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polls := 0
+			c := NewClient(nil)
+			state := tt.state
+			if state == "" {
+				state = TaskRunning
+			}
+			c.store = &mockStore{
+				onTaskStatus: func(uid string) (*TaskStatus, error) {
+					if tt.unknown {
+						return nil, ErrTaskNotFound
+					}
+					return &TaskStatus{uid: uid, state: state}, nil
+				},
+				onTaskResult: func(uid string) ([]byte, error) {
+					polls++
+					if polls > len(tt.results) || tt.results[polls-1] == nil {
+						return nil, ErrTaskNotFound
+					}
+					return tt.results[polls-1], nil
+				},
+				onDeadTask: func(uid string) (*DeadTask, error) {
+					if !tt.dead {
+						return nil, ErrTaskNotFound
+					}
+					return &DeadTask{row: TaskRow{uid: uid, lastError: "test err"}}, nil
+				},
+			}
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			result := &mockResult{}
+			err := c.Result(ctx, "import-1", result)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Client.Result() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(result.body) != tt.wantBody {
+				t.Errorf("Client.Result() body = %s, want %s", result.body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestClient_Cancel(t *testing.T) {
+	tests := []struct {
+		name       string
+		errCancel  error
+		pending    []bool
+		errPending error
+		timeout    time.Duration
+		wantErr    error
+	}{
+		{
+			name: "queued",
+		},
+		{
+			name:      "unknown",
+			errCancel: ErrTaskNotFound,
+			wantErr:   ErrTaskNotFound,
+		},
+		{
+			name:      "acknowledged",
+			errCancel: ErrCancelPending,
+			pending:   []bool{true, false},
+		},
+		{
+			name:       "finished_before_cancel",
+			errCancel:  ErrCancelPending,
+			errPending: ErrTaskNotFound,
+			wantErr:    ErrTaskNotFound,
+		},
+		{
+			name:      "not_acknowledged",
+			errCancel: ErrCancelPending,
+			pending:   []bool{true, true, true, true, true},
+			timeout:   time.Millisecond * 150,
+			wantErr:   ErrCancelPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polls := 0
+			c := NewClient(nil)
+			c.store = &mockStore{
+				onCancel: func(uid string) error {
+					return tt.errCancel
+				},
+				onCancelPending: func(uid string) (bool, error) {
+					polls++
+					if tt.errPending != nil {
+						return false, tt.errPending
+					}
+					return polls <= len(tt.pending) && tt.pending[polls-1], nil
+				},
+			}
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			if err := c.Cancel(ctx, "import-1"); err != tt.wantErr {
+				t.Errorf("Client.Cancel() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package jobq
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron spec. Each field is
+// a bit set of values at which schedule runs
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domAny and dowAny are set when day fields are not restricted.
+	// Days match either of the fields if both are restricted
+	domAny bool
+	dowAny bool
+}
+
+// cronField is a range of values of a cron field
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMinute = cronField{min: 0, max: 59}
+	cronHour   = cronField{min: 0, max: 23}
+	cronDom    = cronField{min: 1, max: 31}
+	cronMonth  = cronField{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Sunday is either 0 or 7
+	cronDow = cronField{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// cronDescriptors are shorthands of common specs
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses standard 5 field cron spec
+// (minute hour day-of-month month day-of-week) or a descriptor
+func parseCron(spec string) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, ErrInvalidCronSpec
+	}
+	var (
+		c   cronSchedule
+		err error
+	)
+	if c.minute, err = cronMinute.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if c.hour, err = cronHour.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if c.dom, err = cronDom.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if c.month, err = cronMonth.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if c.dow, err = cronDow.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*" || fields[2] == "?"
+	c.dowAny = fields[4] == "*" || fields[4] == "?"
+	return &c, nil
+}
+
+// parse parses comma separated list of values, ranges and steps
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, ErrInvalidCronSpec
+			}
+			step = n
+			part = part[:i]
+		}
+		min, max := f.min, f.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			i := strings.Index(part, "-")
+			var err error
+			if min, err = f.value(part[:i]); err != nil {
+				return 0, err
+			}
+			if max, err = f.value(part[i+1:]); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(part)
+			if err != nil {
+				return 0, err
+			}
+			// single value with a step runs from value till the end
+			min = v
+			if step == 1 {
+				max = v
+			}
+		}
+		if min > max {
+			return 0, ErrInvalidCronSpec
+		}
+		for v := min; v <= max; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a number or a name of the field
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, ErrInvalidCronSpec
+	}
+	return v, nil
+}
+
+// next returns the first time after t at which schedule runs, in the
+// location of t. Zero time is returned if schedule does not run in 5 years
+func (c *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay reports whether day of t matches day of month or day of
+// week. Both fields have to match if either is not restricted
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,113 @@
+package jobq
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "every_minute", spec: "* * * * *"},
+		{name: "lists_ranges_steps", spec: "0,30 9-17 */2 1-12/3 mon-fri"},
+		{name: "names", spec: "0 0 * jan SUN"},
+		{name: "descriptor", spec: "@daily"},
+		{name: "value_step", spec: "5/15 * * * *"},
+		{name: "too_few_fields", spec: "* * * *", wantErr: true},
+		{name: "out_of_range", spec: "60 * * * *", wantErr: true},
+		{name: "reversed_range", spec: "* 5-1 * * *", wantErr: true},
+		{name: "zero_step", spec: "*/0 * * * *", wantErr: true},
+		{name: "unknown_name", spec: "* * * foo *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCron(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && err != ErrInvalidCronSpec {
+				t.Errorf("parseCron() error = %v, want %v", err, ErrInvalidCronSpec)
+			}
+		})
+	}
+}
+
+func Test_cronSchedule_next(t *testing.T) {
+	riga, err := time.LoadLocation("Europe/Riga")
+	if err != nil {
+		t.Skip("timezone data is not available")
+	}
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "next_minute",
+			spec: "* * * * *",
+			from: time.Date(2024, 1, 1, 10, 0, 30, 0, time.UTC),
+			want: time.Date(2024, 1, 1, 10, 1, 0, 0, time.UTC),
+		},
+		{
+			name: "exact_time_is_skipped",
+			spec: "*/15 * * * *",
+			from: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC),
+			want: time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "next_year",
+			spec: "@yearly",
+			from: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "weekday",
+			spec: "0 9 * * mon-fri",
+			from: time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC), // Friday
+			want: time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "day_of_month_or_week",
+			spec: "0 0 13 * 5",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), // Monday
+			want: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "sunday_as_7",
+			spec: "0 0 * * 7",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "leap_day",
+			spec: "0 0 29 2 *",
+			from: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "timezone",
+			spec: "0 9 * * *",
+			from: time.Date(2024, 7, 1, 0, 0, 0, 0, riga),
+			want: time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatalf("parseCron() error = %v", err)
+			}
+			if got := c.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("cronSchedule.next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	c, _ := parseCron("0 0 30 2 *")
+	if got := c.next(time.Now()); !got.IsZero() {
+		t.Errorf("cronSchedule.next() = %v, want zero time", got)
+	}
+}
@@ -3,11 +3,15 @@ package jobq
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"time"
 
 	_ "github.com/dbarzdys/jobq/migrate/migrations"
+	"github.com/lib/pq"
 )
 
 const nullTimeLayout = "2006-01-02T15:04:05.999999999"
@@ -54,6 +58,72 @@ func (nt nullTime) Value() (driver.Value, error) {
 	return nt.Time, nil
 }
 
+// nullDuration is stored as milliseconds
+type nullDuration struct {
+	Duration time.Duration
+	Valid    bool
+}
+
+func (nd *nullDuration) Scan(value interface{}) error {
+	ms, ok := value.(int64)
+	nd.Duration, nd.Valid = time.Duration(ms)*time.Millisecond, ok
+	return nil
+}
+
+func (nd nullDuration) Value() (driver.Value, error) {
+	if !nd.Valid {
+		return nil, nil
+	}
+	return int64(nd.Duration / time.Millisecond), nil
+}
+
+// taskHeaders are stored as JSON object and
+// are used as trace context carrier
+type taskHeaders map[string]string
+
+func (h *taskHeaders) Scan(value interface{}) error {
+	*h = nil
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, h)
+}
+
+func (h taskHeaders) Value() (driver.Value, error) {
+	if len(h) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(h)
+}
+
+// Get returns header value
+func (h taskHeaders) Get(key string) string {
+	return h[key]
+}
+
+// Set sets header value
+func (h taskHeaders) Set(key, value string) {
+	h[key] = value
+}
+
+func (h taskHeaders) copy() map[string]string {
+	headers := make(map[string]string, len(h))
+	for key, value := range h {
+		headers[key] = value
+	}
+	return headers
+}
+
+// Keys returns header keys
+func (h taskHeaders) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 // DBExecer makes execs
 type DBExecer interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
@@ -77,29 +147,292 @@ type Tx interface {
 	Rollback() error
 }
 
-func queueTask(e DBExecer, row *TaskRow) error {
-	stmt := `
+// taskColumns are columns that are set when task is queued
+var taskColumns = []string{
+	"uid",
+	"job_name",
+	"body",
+	"retries",
+	"timeout",
+	"start_at",
+	"retry_policy",
+	"ttl",
+	"headers",
+	"priority",
+	"queue",
+	"unique_key",
+}
+
+const insertTaskStmt = `
 		INSERT INTO jobq_tasks (
 			uid,
 			job_name,
 			body,
 			retries,
 			timeout,
-			start_at
-		) VALUES ($1, $2, $3, $4, $5, $6);
-	`
-	_, err := e.Exec(
-		stmt,
+			start_at,
+			retry_policy,
+			ttl,
+			headers,
+			priority,
+			queue,
+			unique_key
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+// queueTask inserts task. Task with unique key is not inserted if
+// task with the same key exists and row uid is set to uid of the
+// existing task when e is also a DBQueryer. Error wrapping
+// ErrDuplicateTask is returned if existing task can't be looked up
+func queueTask(e DBExecer, row *TaskRow) error {
+	args := row.queueArgs()
+	if !row.uniqueKey.Valid {
+		_, err := e.Exec(insertTaskStmt+";", args...)
+		return duplicateTaskError(err)
+	}
+	stmt := insertTaskStmt + `
+		ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING`
+	q, ok := e.(DBQueryer)
+	if !ok {
+		_, err := e.Exec(stmt+";", args...)
+		return duplicateTaskError(err)
+	}
+	// existing task is looked up first, since select does not wait for
+	// transactions handling it. Existing task can be finished before
+	// it's uid is selected, so lookup and insert are retried once
+	for i := 0; i < 2; i++ {
+		uid, err := selectUniqueTaskUID(q, row.uniqueKey.String)
+		if err == nil {
+			row.uid = uid
+			return nil
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		inserted, err := queryExists(q, stmt+`
+		RETURNING uid;`, args...)
+		if err != nil || inserted {
+			return duplicateTaskError(err)
+		}
+	}
+	// task with the same key kept being queued or finished
+	// between lookups and inserts, so it's uid is unknown
+	return fmt.Errorf("unique key %s: %w", row.uniqueKey.String, ErrDuplicateTask)
+}
+
+// uniqueKeyConflict reports whether err is a violation of task unique key index
+func uniqueKeyConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "jobq_task_unique_key_idx"
+}
+
+// queueArgs returns values of taskColumns
+func (row *TaskRow) queueArgs() []interface{} {
+	return []interface{}{
 		row.uid,
 		row.jobName,
 		row.body,
 		row.retries,
 		row.timeout,
 		row.startAt,
-	)
+		row.retryPolicy,
+		row.ttl,
+		row.headers,
+		row.priority,
+		row.queue,
+		row.uniqueKey,
+	}
+}
+
+// maxBatchRows limits rows inserted by a single statement,
+// so that statement would not exceed parameter limit
+const maxBatchRows = 1000
+
+// queueTasks inserts tasks using multi-row insert statements. Tasks
+// with unique keys are skipped if task with the same key exists and
+// their uids are set to uids of existing tasks when e is also a
+// DBQueryer. Otherwise error wrapping ErrDuplicateTask is returned
+// if any task was skipped
+func queueTasks(e DBExecer, rows []*TaskRow) error {
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > maxBatchRows {
+			n = maxBatchRows
+		}
+		if err := insertTasks(e, rows[:n]); err != nil {
+			return err
+		}
+		rows = rows[n:]
+	}
+	return nil
+}
+
+// insertTasks inserts tasks using a single statement
+func insertTasks(e DBExecer, rows []*TaskRow) error {
+	unique := 0
+	for _, row := range rows {
+		if row.uniqueKey.Valid {
+			unique++
+		}
+	}
+	stmt, args := insertTasksStmt(rows)
+	q, ok := e.(DBQueryer)
+	if unique == 0 || !ok {
+		res, err := e.Exec(stmt, args...)
+		if err != nil || unique == 0 {
+			return duplicateTaskError(err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if skipped := int64(len(rows)) - n; skipped > 0 {
+			return fmt.Errorf("%d tasks: %w", skipped, ErrDuplicateTask)
+		}
+		return nil
+	}
+	inserted, err := queryUIDs(q, stmt, args...)
+	if err != nil {
+		return duplicateTaskError(err)
+	}
+	for _, row := range rows {
+		if inserted[row.uid] {
+			continue
+		}
+		// task with the same unique key exists, so it's uid is looked
+		// up or task is queued again if existing task has finished
+		if err = queueTask(e, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertTasksStmt(rows []*TaskRow) (string, []interface{}) {
+	var b strings.Builder
+	args := make([]interface{}, 0, len(rows)*len(taskColumns))
+	unique := false
+	b.WriteString("INSERT INTO jobq_tasks (")
+	b.WriteString(strings.Join(taskColumns, ", "))
+	b.WriteString(") VALUES ")
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j := range taskColumns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", len(args)+j+1)
+		}
+		b.WriteString(")")
+		args = append(args, row.queueArgs()...)
+		unique = unique || row.uniqueKey.Valid
+	}
+	if unique {
+		b.WriteString(" ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING RETURNING uid")
+	}
+	b.WriteString(";")
+	return b.String(), args
+}
+
+// copyTasks inserts tasks using COPY
+func copyTasks(tx *sql.Tx, rows []*TaskRow) error {
+	stmt, err := tx.Prepare(pq.CopyIn("jobq_tasks", taskColumns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		args, err := copyArgs(row.queueArgs())
+		if err != nil {
+			return err
+		}
+		if _, err = stmt.Exec(args...); err != nil {
+			return duplicateTaskError(err)
+		}
+	}
+	if _, err = stmt.Exec(); err != nil {
+		return duplicateTaskError(err)
+	}
+	return nil
+}
+
+// copyArgs converts values for COPY. COPY encodes []byte as bytea,
+// so JSON values are converted to strings
+func copyArgs(args []interface{}) ([]interface{}, error) {
+	for i, arg := range args {
+		if valuer, ok := arg.(driver.Valuer); ok {
+			v, err := valuer.Value()
+			if err != nil {
+				return nil, err
+			}
+			arg = v
+		}
+		if b, ok := arg.([]byte); ok {
+			arg = string(b)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// duplicateTaskError returns ErrDuplicateTask
+// if err is violation of task uid uniqueness
+func duplicateTaskError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "jobq_task_uid_unique" {
+		return ErrDuplicateTask
+	}
 	return err
 }
 
+// queryExists reports whether query returned any rows
+func queryExists(q DBQueryer, stmt string, args ...interface{}) (bool, error) {
+	rows, err := q.Query(stmt, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// queryUIDs returns uids returned by query
+func queryUIDs(q DBQueryer, stmt string, args ...interface{}) (map[string]bool, error) {
+	rows, err := q.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	uids := make(map[string]bool)
+	for rows.Next() {
+		var uid string
+		if err = rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		uids[uid] = true
+	}
+	return uids, rows.Err()
+}
+
+func selectUniqueTaskUID(q DBQueryer, uniqueKey string) (string, error) {
+	stmt := `
+		SELECT uid FROM jobq_tasks
+		WHERE unique_key = $1;
+	`
+	rows, err := q.Query(stmt, uniqueKey)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", sql.ErrNoRows
+	}
+	var uid string
+	err = rows.Scan(&uid)
+	return uid, err
+}
+
 func requeueTask(e DBExecer, row *TaskRow) error {
 	stmt := `
 		INSERT INTO jobq_tasks (
@@ -108,9 +441,19 @@ func requeueTask(e DBExecer, row *TaskRow) error {
 			job_name,
 			body,
 			retries,
+			attempts,
 			timeout,
-			start_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7);
+			start_at,
+			retry_policy,
+			last_error,
+			created_at,
+			last_attempted_at,
+			ttl,
+			headers,
+			priority,
+			queue,
+			unique_key
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17);
 	`
 	_, err := e.Exec(
 		stmt,
@@ -119,44 +462,934 @@ func requeueTask(e DBExecer, row *TaskRow) error {
 		row.jobName,
 		row.body,
 		row.retries,
+		row.attempts,
 		row.timeout,
 		row.startAt,
+		row.retryPolicy,
+		row.lastError,
+		row.createdAt,
+		row.lastAttemptedAt,
+		row.ttl,
+		row.headers,
+		row.priority,
+		row.queue,
+		row.uniqueKey,
 	)
 	return err
 }
 
-func dequeueTask(e DBQueryer, name string) (*TaskRow, error) {
-	row := new(TaskRow)
+// dequeueOrder returns ordering of tasks by priority. When aging is
+// enabled, priority is raised by 1 every aging interval task waits.
+// Aged priority is computed on dequeue, so it can't be read from
+// jobq_task_queue_priority_idx and every ready task of the queue is sorted
+func dequeueOrder(aging time.Duration) string {
+	if aging <= 0 {
+		return "priority DESC, id ASC"
+	}
+	return fmt.Sprintf(
+		"priority + FLOOR(EXTRACT(EPOCH FROM NOW() - COALESCE(created_at, NOW())) * 1000 / %d) DESC, id ASC",
+		int64(aging/time.Millisecond),
+	)
+}
+
+// readyTasks selects up to limit ids of tasks of the queue
+// that are ready to be handled and not leased by workers
+const readyTasks = `
+	SELECT id FROM jobq_tasks
+	WHERE queue = $1
+	AND job_name = ANY($2)
+	AND (timeout IS NULL OR timeout < NOW())
+	AND (start_at IS NULL OR start_at < NOW())
+	AND locked_until IS NULL
+	ORDER BY %s
+	FOR UPDATE SKIP LOCKED
+	LIMIT $3
+`
+
+// dequeuedColumns are task columns returned by dequeue and lease queries
+const dequeuedColumns = `id, uid, job_name, body, retries, attempts, timeout, start_at, retry_policy,
+	last_error, created_at, last_attempted_at, ttl, headers, priority, unique_key`
+
+// taskLockKey is the first key of advisory locks taken on ids
+// of tasks claimed in transaction, so that running tasks can be
+// told apart from rows locked by other statements
+const taskLockKey = 0x6a6f6274
+
+// taskLockID is the second key of advisory lock taken on task id
+const taskLockID = `(id & 2147483647)::int`
+
+// dequeueTasks deletes and returns up to limit tasks
+// of the queue that are ready to be handled. Advisory lock
+// is taken on each returned task until the end of transaction
+func dequeueTasks(e DBQueryer, queue string, jobNames []string, limit int, aging time.Duration) ([]*TaskRow, error) {
+	stmt := fmt.Sprintf(`
+		WITH claimed AS (
+			DELETE FROM jobq_tasks WHERE id IN (`+readyTasks+`) RETURNING `+dequeuedColumns+`
+		)
+		SELECT `+dequeuedColumns+` FROM claimed,
+			LATERAL (SELECT pg_advisory_xact_lock(%d, `+taskLockID+`)) l;
+	`, dequeueOrder(aging), taskLockKey)
+	rows, err := e.Query(stmt, queue, pq.Array(jobNames), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDequeuedTasks(rows, queue)
+}
+
+// leaseTasks locks up to limit tasks of the queue by owner until lease
+// expires and returns them. Attempt is counted when task is leased, so
+// that tasks reaped after their workers crashed keep their attempts
+func leaseTasks(e DBQueryer, queue string, jobNames []string, limit int, owner string, lease, aging time.Duration) ([]*TaskRow, error) {
+	stmt := fmt.Sprintf(`
+		UPDATE jobq_tasks SET locked_by = $4, locked_until = NOW() + $5 * INTERVAL '1 millisecond',
+			attempts = attempts + 1
+		WHERE id IN (`+readyTasks+`) RETURNING `+dequeuedColumns+`;
+	`, dequeueOrder(aging))
+	rows, err := e.Query(stmt, queue, pq.Array(jobNames), limit, owner, int64(lease/time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	return scanDequeuedTasks(rows, queue)
+}
+
+func scanDequeuedTasks(rows *sql.Rows, queue string) ([]*TaskRow, error) {
+	defer rows.Close()
+	var out []*TaskRow
+	for rows.Next() {
+		row := &TaskRow{queue: queue}
+		err := rows.Scan(
+			&row.id,
+			&row.uid,
+			&row.jobName,
+			&row.body,
+			&row.retries,
+			&row.attempts,
+			&row.timeout,
+			&row.startAt,
+			&row.retryPolicy,
+			&row.lastError,
+			&row.createdAt,
+			&row.lastAttemptedAt,
+			&row.ttl,
+			&row.headers,
+			&row.priority,
+			&row.uniqueKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return out, nil
+}
+
+// countQueuedTasks returns number of pending and running
+// tasks of the queues by queue and job name
+func countQueuedTasks(e DBQueryer, queues []string) (map[string]map[string]int, error) {
 	stmt := `
-		DELETE FROM jobq_tasks WHERE id = (
-			SELECT id FROM jobq_tasks
-			WHERE job_name = $1
-			AND (timeout IS NULL OR timeout < NOW())
-			AND (start_at IS NULL OR start_at < NOW())
-			ORDER BY id ASC
-			FOR UPDATE SKIP LOCKED
-			LIMIT 1
-		) RETURNING id, uid, body, retries, timeout, start_at;
+		SELECT queue, job_name, COUNT(*) FROM jobq_tasks
+		WHERE queue = ANY($1)
+		GROUP BY queue, job_name;
+	`
+	rows, err := e.Query(stmt, pq.Array(queues))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	depths := make(map[string]map[string]int)
+	for rows.Next() {
+		var (
+			queue, jobName string
+			count          int
+		)
+		if err = rows.Scan(&queue, &jobName, &count); err != nil {
+			return nil, err
+		}
+		if depths[queue] == nil {
+			depths[queue] = make(map[string]int)
+		}
+		depths[queue][jobName] = count
+	}
+	return depths, rows.Err()
+}
+
+// countStrandedTasks returns number of ready tasks of the jobs that are
+// waiting longer than age in queues other than given ones by queue and job name
+func countStrandedTasks(e DBQueryer, jobNames, queues []string, age time.Duration) (map[string]map[string]int, error) {
+	stmt := `
+		SELECT queue, job_name, COUNT(*) FROM jobq_tasks
+		WHERE job_name = ANY($1)
+		AND NOT queue = ANY($2)
+		AND locked_until IS NULL
+		AND (timeout IS NULL OR timeout < NOW())
+		AND (start_at IS NULL OR start_at < NOW())
+		AND created_at < NOW() - $3 * INTERVAL '1 millisecond'
+		GROUP BY queue, job_name;
+	`
+	rows, err := e.Query(stmt, pq.Array(jobNames), pq.Array(queues), int64(age/time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stranded := make(map[string]map[string]int)
+	for rows.Next() {
+		var (
+			queue, jobName string
+			count          int
+		)
+		if err = rows.Scan(&queue, &jobName, &count); err != nil {
+			return nil, err
+		}
+		if stranded[queue] == nil {
+			stranded[queue] = make(map[string]int)
+		}
+		stranded[queue][jobName] = count
+	}
+	return stranded, rows.Err()
+}
+
+// extendLeases moves lease expiry of tasks still locked by owner
+// and reports how many leases were extended
+func extendLeases(e DBExecer, ids []int64, owner string, lease time.Duration) (int64, error) {
+	stmt := `
+		UPDATE jobq_tasks SET locked_until = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = ANY($1) AND locked_by = $2;
+	`
+	res, err := e.Exec(stmt, pq.Array(ids), owner, int64(lease/time.Millisecond))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// releaseLeases returns tasks locked by owner to the queue
+func releaseLeases(e DBExecer, ids []int64, owner string) error {
+	stmt := `
+		UPDATE jobq_tasks SET locked_by = NULL, locked_until = NULL
+		WHERE id = ANY($1) AND locked_by = $2;
+	`
+	_, err := e.Exec(stmt, pq.Array(ids), owner)
+	return err
+}
+
+// deleteLeasedTask deletes task if it is still locked by owner
+// and reports whether it was deleted
+func deleteLeasedTask(e DBExecer, id int64, owner string) (bool, error) {
+	stmt := `
+		DELETE FROM jobq_tasks WHERE id = $1 AND locked_by = $2;
 	`
-	rows, err := e.Query(stmt, name)
+	res, err := e.Exec(stmt, id, owner)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// reapLeases returns tasks with expired leases to the queue
+// and reports how many tasks were returned to each queue
+func reapLeases(e DBQueryer) (map[string]int, error) {
+	stmt := `
+		UPDATE jobq_tasks SET locked_by = NULL, locked_until = NULL
+		WHERE locked_until < NOW() RETURNING queue;
+	`
+	rows, err := e.Query(stmt)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	reaped := make(map[string]int)
+	for rows.Next() {
+		var queue string
+		if err = rows.Scan(&queue); err != nil {
+			return nil, err
+		}
+		reaped[queue]++
+	}
+	return reaped, rows.Err()
+}
+
+// buryTask moves task to dead tasks. Task with the same uid can be
+// queued again after it's buried, so the last failure replaces it
+func buryTask(e DBExecer, row *TaskRow, lastError string) error {
+	stmt := `
+		INSERT INTO jobq_dead_tasks (
+			uid,
+			job_name,
+			body,
+			retries,
+			attempts,
+			last_error,
+			retry_policy,
+			created_at,
+			last_attempted_at,
+			ttl,
+			headers,
+			priority,
+			queue,
+			unique_key
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (uid) DO UPDATE SET
+			job_name = EXCLUDED.job_name,
+			body = EXCLUDED.body,
+			retries = EXCLUDED.retries,
+			attempts = EXCLUDED.attempts,
+			last_error = EXCLUDED.last_error,
+			retry_policy = EXCLUDED.retry_policy,
+			created_at = EXCLUDED.created_at,
+			last_attempted_at = EXCLUDED.last_attempted_at,
+			ttl = EXCLUDED.ttl,
+			headers = EXCLUDED.headers,
+			priority = EXCLUDED.priority,
+			queue = EXCLUDED.queue,
+			unique_key = EXCLUDED.unique_key,
+			failed_at = NOW();
+	`
+	_, err := e.Exec(
+		stmt,
+		row.uid,
+		row.jobName,
+		row.body,
+		row.retries,
+		row.attempts,
+		lastError,
+		row.retryPolicy,
+		row.createdAt,
+		row.lastAttemptedAt,
+		row.ttl,
+		row.headers,
+		row.priority,
+		row.queue,
+		row.uniqueKey,
+	)
+	return err
+}
+
+func selectDeadTasks(e DBQueryer, jobName string, limit, offset int) ([]*DeadTask, error) {
+	stmt := `
+		SELECT id, uid, job_name, body, retries, attempts, last_error,
+			created_at, last_attempted_at, failed_at, headers, queue
+		FROM jobq_dead_tasks
+		WHERE ($1 = '' OR job_name = $1)
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3;
+	`
+	rows, err := e.Query(stmt, jobName, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tasks := []*DeadTask{}
+	for rows.Next() {
+		task, err := scanDeadTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+func selectDeadTask(e DBQueryer, uid string) (*DeadTask, error) {
+	stmt := `
+		SELECT id, uid, job_name, body, retries, attempts, last_error,
+			created_at, last_attempted_at, failed_at, headers, queue
+		FROM jobq_dead_tasks
+		WHERE uid = $1;
+	`
+	rows, err := e.Query(stmt, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	if !rows.Next() {
 		return nil, sql.ErrNoRows
 	}
+	return scanDeadTask(rows)
+}
+
+func scanDeadTask(rows *sql.Rows) (*DeadTask, error) {
+	task := new(DeadTask)
+	var failedAt nullTime
+	err := rows.Scan(
+		&task.row.id,
+		&task.row.uid,
+		&task.row.jobName,
+		&task.row.body,
+		&task.row.retries,
+		&task.row.attempts,
+		&task.row.lastError,
+		&task.row.createdAt,
+		&task.row.lastAttemptedAt,
+		&failedAt,
+		&task.row.headers,
+		&task.row.queue,
+	)
+	if err != nil {
+		return nil, err
+	}
+	task.failedAt = failedAt.Time
+	return task, nil
+}
+
+func requeueDeadTask(e DBExecer, uid string) (int64, error) {
+	stmt := `
+		WITH dead AS (
+			DELETE FROM jobq_dead_tasks
+			WHERE uid = $1
+			RETURNING uid, job_name, body, retries, retry_policy, created_at, ttl, headers, priority, queue, unique_key
+		)
+		INSERT INTO jobq_tasks (
+			uid,
+			job_name,
+			body,
+			retries,
+			retry_policy,
+			created_at,
+			ttl,
+			headers,
+			priority,
+			queue,
+			unique_key
+		) SELECT uid, job_name, body, retries, retry_policy, created_at, ttl, headers, priority, queue, unique_key FROM dead;
+	`
+	res, err := e.Exec(stmt, uid)
+	if uniqueKeyConflict(err) {
+		// task with the same unique key is pending or running
+		return 0, ErrDuplicateTask
+	}
+	if err != nil {
+		return 0, duplicateTaskError(err)
+	}
+	return res.RowsAffected()
+}
+
+func purgeDeadTasks(e DBExecer, jobName string, before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM jobq_dead_tasks
+		WHERE ($1 = '' OR job_name = $1)
+		AND failed_at < $2;
+	`
+	res, err := e.Exec(stmt, jobName, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// upsertTaskProgress stores last reported progress of a task
+func upsertTaskProgress(e DBExecer, uid string, percent float64, message string) error {
+	stmt := `
+		INSERT INTO jobq_task_progress (uid, percent, message, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (uid) DO UPDATE SET
+			percent = EXCLUDED.percent,
+			message = EXCLUDED.message,
+			updated_at = EXCLUDED.updated_at;
+	`
+	_, err := e.Exec(stmt, uid, percent, message)
+	return err
+}
+
+// selectTaskStatus returns state and progress of a task. Leased tasks
+// and tasks deleted by a dequeue transaction that is still in progress
+// are reported as running, the latter by advisory locks taken on their
+// ids when they were claimed. Tasks that left the queue are reported as
+// canceled if their last history entry is canceled. Rows are not locked,
+// so that status checks would not block or be skipped by dequeues
+func selectTaskStatus(e DBQueryer, uid string) (*TaskStatus, error) {
+	stmt := fmt.Sprintf(`
+		SELECT
+			CASE
+				WHEN EXISTS (SELECT 1 FROM jobq_dead_tasks WHERE uid = $1) THEN 'dead'
+				WHEN t.uid IS NULL AND (
+					SELECT h.status FROM jobq_task_history h
+					WHERE h.uid = $1
+					ORDER BY h.id DESC
+					LIMIT 1
+				) = 'canceled' THEN 'canceled'
+				WHEN t.uid IS NULL THEN 'finished'
+				WHEN t.locked_until IS NOT NULL OR EXISTS (
+					SELECT 1 FROM pg_locks l
+					WHERE l.locktype = 'advisory'
+					AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+					AND l.classid::bigint = %d
+					AND l.objid::bigint = t.id & 2147483647
+					AND l.objsubid = 2
+				) THEN 'running'
+				ELSE 'queued'
+			END,
+			p.uid IS NOT NULL,
+			COALESCE(p.percent, 0),
+			COALESCE(p.message, ''),
+			p.updated_at
+		FROM (SELECT $1::varchar AS uid) u
+		LEFT JOIN jobq_tasks t ON t.uid = u.uid
+		LEFT JOIN jobq_task_progress p ON p.uid = u.uid;
+	`, taskLockKey)
+	rows, err := e.Query(stmt, uid)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	status := &TaskStatus{uid: uid}
+	var reported bool
 	err = rows.Scan(
+		&status.state,
+		&reported,
+		&status.percent,
+		&status.message,
+		&status.updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if status.state == TaskFinished && !reported {
+		return nil, sql.ErrNoRows
+	}
+	return status, nil
+}
+
+// upsertTaskResult stores result of a finished task until retention passes.
+// Result is stored in the claim transaction, which started before the task
+// was handled, so clock_timestamp() is used instead of NOW()
+func upsertTaskResult(e DBExecer, row *TaskRow, result []byte, retention time.Duration) error {
+	stmt := `
+		INSERT INTO jobq_task_results (uid, job_name, body, created_at, expires_at)
+		VALUES ($1, $2, $3, clock_timestamp(), clock_timestamp() + $4 * INTERVAL '1 millisecond')
+		ON CONFLICT (uid) DO UPDATE SET
+			job_name = EXCLUDED.job_name,
+			body = EXCLUDED.body,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at;
+	`
+	_, err := e.Exec(stmt, row.uid, row.jobName, result, int64(retention/time.Millisecond))
+	return err
+}
+
+func selectTaskResult(e DBQueryer, uid string) ([]byte, error) {
+	stmt := `
+		SELECT body FROM jobq_task_results
+		WHERE uid = $1 AND expires_at > NOW();
+	`
+	rows, err := e.Query(stmt, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	var body []byte
+	err = rows.Scan(&body)
+	return body, err
+}
+
+func purgeTaskResults(e DBExecer) (int64, error) {
+	stmt := `
+		DELETE FROM jobq_task_results WHERE expires_at < NOW();
+	`
+	res, err := e.Exec(stmt)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// purgeTaskProgress deletes progress of tasks
+// that were not in the queue since given time
+func purgeTaskProgress(e DBExecer, before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM jobq_task_progress p
+		WHERE p.updated_at < $1
+		AND NOT EXISTS (SELECT 1 FROM jobq_tasks t WHERE t.uid = p.uid);
+	`
+	res, err := e.Exec(stmt, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// insertTaskHistory keeps finished task in history. finished_at is set
+// with clock_timestamp(), since NOW() of the claim transaction is the time
+// task was claimed at
+func insertTaskHistory(e DBExecer, row *TaskRow, status TaskState, worker string, duration time.Duration) error {
+	stmt := `
+		INSERT INTO jobq_task_history (
+			uid,
+			job_name,
+			queue,
+			status,
+			attempts,
+			worker,
+			duration,
+			created_at,
+			finished_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, clock_timestamp());
+	`
+	_, err := e.Exec(
+		stmt,
+		row.uid,
+		row.jobName,
+		row.queue,
+		string(status),
+		row.attempts,
+		worker,
+		nullDuration{Valid: true, Duration: duration},
+		row.createdAt,
+	)
+	return err
+}
+
+func selectTaskHistory(e DBQueryer, uid string) ([]*HistoryEntry, error) {
+	stmt := `
+		SELECT uid, job_name, queue, status, attempts, worker, duration, created_at, finished_at
+		FROM jobq_task_history
+		WHERE uid = $1
+		ORDER BY finished_at ASC, id ASC;
+	`
+	rows, err := e.Query(stmt, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []*HistoryEntry
+	for rows.Next() {
+		entry := new(HistoryEntry)
+		err = rows.Scan(
+			&entry.uid,
+			&entry.jobName,
+			&entry.queue,
+			&entry.status,
+			&entry.attempts,
+			&entry.worker,
+			&entry.duration,
+			&entry.createdAt,
+			&entry.finishedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func purgeTaskHistory(e DBExecer, before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM jobq_task_history WHERE finished_at < $1;
+	`
+	res, err := e.Exec(stmt, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// purgeCanceledTaskHistory deletes history entries of canceled tasks
+func purgeCanceledTaskHistory(e DBExecer, before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM jobq_task_history WHERE status = $1 AND finished_at < $2;
+	`
+	res, err := e.Exec(stmt, string(TaskCanceled), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// cancelQueuedTask deletes task that is not claimed by a worker and
+// returns it. Tasks locked by dequeue transactions or leases are kept
+func cancelQueuedTask(e DBQueryer, uid string) (*TaskRow, error) {
+	stmt := `
+		DELETE FROM jobq_tasks WHERE id IN (
+			SELECT id FROM jobq_tasks
+			WHERE uid = $1 AND locked_until IS NULL
+			FOR UPDATE SKIP LOCKED
+		) RETURNING id, uid, job_name, queue, attempts, created_at;
+	`
+	rows, err := e.Query(stmt, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	return scanCanceledTask(rows)
+}
+
+// scanCanceledTask scans task columns kept in history of canceled tasks
+func scanCanceledTask(rows *sql.Rows) (*TaskRow, error) {
+	row := new(TaskRow)
+	err := rows.Scan(
 		&row.id,
 		&row.uid,
-		&row.body,
-		&row.retries,
-		&row.timeout,
-		&row.startAt,
+		&row.jobName,
+		&row.queue,
+		&row.attempts,
+		&row.createdAt,
 	)
 	if err != nil {
 		return nil, err
 	}
-	row.jobName = name
 	return row, nil
 }
+
+// notifyTaskCanceled notifies workers that running task was
+// canceled and reports whether task was found in the queue
+func notifyTaskCanceled(e DBExecer, uid string) (bool, error) {
+	stmt := `
+		SELECT pg_notify('jobq_task_canceled', uid) FROM jobq_tasks WHERE uid = $1;
+	`
+	res, err := e.Exec(stmt, uid)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// insertTaskCancel records cancel request of a claimed task, so that
+// it is canceled even if no worker is notified. It reports whether
+// task was found in the queue
+func insertTaskCancel(e DBExecer, uid string) (bool, error) {
+	stmt := `
+		INSERT INTO jobq_task_cancels (task_id, uid)
+		SELECT id, uid FROM jobq_tasks WHERE uid = $1
+		ON CONFLICT (task_id) DO UPDATE SET created_at = NOW();
+	`
+	res, err := e.Exec(stmt, uid)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// selectTaskCancels returns ids of tasks that have cancel requests
+func selectTaskCancels(q DBQueryer, ids []int64) (map[int64]bool, error) {
+	stmt := `
+		SELECT task_id FROM jobq_task_cancels WHERE task_id = ANY($1);
+	`
+	rows, err := q.Query(stmt, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	canceled := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		canceled[id] = true
+	}
+	return canceled, rows.Err()
+}
+
+// deleteTaskCancel acknowledges cancel request of a canceled task
+func deleteTaskCancel(e DBExecer, id int64) error {
+	stmt := `
+		DELETE FROM jobq_task_cancels WHERE task_id = $1;
+	`
+	_, err := e.Exec(stmt, id)
+	return err
+}
+
+// selectTaskCancelPending reports whether the last cancel request of
+// a task is not acknowledged while task is still in the queue.
+// sql.ErrNoRows is returned if there is no cancel request
+func selectTaskCancelPending(q DBQueryer, uid string) (bool, error) {
+	stmt := `
+		SELECT EXISTS (SELECT 1 FROM jobq_tasks t WHERE t.id = c.task_id)
+		FROM jobq_task_cancels c
+		WHERE c.uid = $1
+		ORDER BY c.task_id DESC
+		LIMIT 1;
+	`
+	rows, err := q.Query(stmt, uid)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return false, err
+		}
+		return false, sql.ErrNoRows
+	}
+	var pending bool
+	err = rows.Scan(&pending)
+	return pending, err
+}
+
+// deleteCanceledLeases deletes tasks of expired leases that have cancel
+// requests, so that reaper would not return them to the queue
+func deleteCanceledLeases(q DBQueryer) ([]*TaskRow, error) {
+	stmt := `
+		WITH canceled AS (
+			DELETE FROM jobq_tasks t USING jobq_task_cancels c
+			WHERE c.task_id = t.id AND t.locked_until < NOW()
+			RETURNING t.id, t.uid, t.job_name, t.queue, t.attempts, t.created_at
+		), acknowledged AS (
+			DELETE FROM jobq_task_cancels WHERE task_id IN (SELECT id FROM canceled)
+		)
+		SELECT id, uid, job_name, queue, attempts, created_at FROM canceled;
+	`
+	rows, err := q.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var canceled []*TaskRow
+	for rows.Next() {
+		row, err := scanCanceledTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		canceled = append(canceled, row)
+	}
+	return canceled, rows.Err()
+}
+
+// purgeTaskCancels deletes cancel requests of tasks
+// that left the queue before given time
+func purgeTaskCancels(e DBExecer, before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM jobq_task_cancels c
+		WHERE c.created_at < $1
+		AND NOT EXISTS (SELECT 1 FROM jobq_tasks t WHERE t.id = c.task_id);
+	`
+	res, err := e.Exec(stmt, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// inSavepoint runs f in a savepoint of transaction
+// and rolls back changes made by f if it fails
+func inSavepoint(e DBExecer, name string, f func() error) error {
+	if _, err := e.Exec("SAVEPOINT " + name + ";"); err != nil {
+		return err
+	}
+	if err := f(); err != nil {
+		if _, rbErr := e.Exec("ROLLBACK TO SAVEPOINT " + name + ";"); rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	_, err := e.Exec("RELEASE SAVEPOINT " + name + ";")
+	return err
+}
+
+// upsertSchedule saves schedule. Next run of existing
+// schedule is kept unless it's spec or timezone changed
+func upsertSchedule(e DBExecer, row *ScheduleRow) error {
+	stmt := `
+		INSERT INTO jobq_schedules (name, job_name, spec, timezone, next_run_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET
+			job_name = EXCLUDED.job_name,
+			spec = EXCLUDED.spec,
+			timezone = EXCLUDED.timezone,
+			next_run_at = CASE
+				WHEN jobq_schedules.spec = EXCLUDED.spec
+				AND jobq_schedules.timezone = EXCLUDED.timezone
+				THEN jobq_schedules.next_run_at
+				ELSE EXCLUDED.next_run_at
+			END,
+			updated_at = NOW();
+	`
+	_, err := e.Exec(stmt, row.name, row.jobName, row.spec, row.timezone, row.nextRunAt)
+	return err
+}
+
+// scheduleLockKey is a key of advisory lock taken
+// by the manager that queues tasks of schedules
+const scheduleLockKey = 0x6a6f6271
+
+// lockSchedules takes advisory lock until the end of transaction
+// and reports whether it was taken
+func lockSchedules(q DBQueryer) (bool, error) {
+	stmt := `
+		SELECT pg_try_advisory_xact_lock($1);
+	`
+	rows, err := q.Query(stmt, scheduleLockKey)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	var locked bool
+	if rows.Next() {
+		if err = rows.Scan(&locked); err != nil {
+			return false, err
+		}
+	}
+	return locked, rows.Err()
+}
+
+// selectDueSchedules locks and returns schedules
+// with next run before given time
+func selectDueSchedules(q DBQueryer, names []string, until time.Time) ([]*ScheduleRow, error) {
+	stmt := `
+		SELECT name, job_name, spec, timezone, next_run_at, last_run_at
+		FROM jobq_schedules
+		WHERE name = ANY($1) AND next_run_at <= $2
+		ORDER BY next_run_at ASC
+		FOR UPDATE;
+	`
+	rows, err := q.Query(stmt, pq.Array(names), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*ScheduleRow
+	for rows.Next() {
+		row := new(ScheduleRow)
+		err = rows.Scan(
+			&row.name,
+			&row.jobName,
+			&row.spec,
+			&row.timezone,
+			&row.nextRunAt,
+			&row.lastRunAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return out, nil
+}
+
+// updateScheduleRuns moves next run of a schedule
+func updateScheduleRuns(e DBExecer, row *ScheduleRow) error {
+	stmt := `
+		UPDATE jobq_schedules
+		SET next_run_at = $2, last_run_at = $3, updated_at = NOW()
+		WHERE name = $1;
+	`
+	_, err := e.Exec(stmt, row.name, row.nextRunAt, row.lastRunAt)
+	return err
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type mockDBExecer struct {
@@ -17,6 +19,7 @@ type mockDBExecer struct {
 	gotStmt  string
 	gotArgs  []interface{}
 	valid    bool
+	affected int64
 }
 
 func (e *mockDBExecer) Exec(stmt string, args ...interface{}) (sql.Result, error) {
@@ -41,7 +44,7 @@ end:
 	if e.wantErr {
 		return nil, errors.New("mock err")
 	}
-	return nil, nil
+	return driver.RowsAffected(e.affected), nil
 }
 
 type mockDBQueryer struct {
@@ -254,3 +257,202 @@ func Test_nullTime_Value(t *testing.T) {
 		})
 	}
 }
+
+func Test_nullDuration(t *testing.T) {
+	nd := nullDuration{
+		Valid:    true,
+		Duration: time.Second * 90,
+	}
+	value, err := nd.Value()
+	if err != nil || value != int64(90000) {
+		t.Errorf("nullDuration.Value() = %v, error = %v, want %v", value, err, int64(90000))
+	}
+	var got nullDuration
+	got.Scan(value)
+	if got != nd {
+		t.Errorf("nullDuration.Scan() = %v, want %v", got, nd)
+	}
+	got.Scan(nil)
+	if got.Valid {
+		t.Errorf("nullDuration.Scan(nil) = %v, want invalid", got)
+	}
+	if value, _ = got.Value(); value != nil {
+		t.Errorf("nullDuration.Value() = %v, want nil", value)
+	}
+}
+
+func Test_taskHeaders(t *testing.T) {
+	h := taskHeaders{"traceparent": "00-abc-def-01"}
+	value, err := h.Value()
+	if err != nil {
+		t.Fatalf("taskHeaders.Value() error = %v", err)
+	}
+	var got taskHeaders
+	if err = got.Scan(value); err != nil {
+		t.Fatalf("taskHeaders.Scan() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("taskHeaders.Scan() = %v, want %v", got, h)
+	}
+	got.Scan(nil)
+	if got != nil {
+		t.Errorf("taskHeaders.Scan(nil) = %v, want nil", got)
+	}
+	if value, _ = got.Value(); value != nil {
+		t.Errorf("taskHeaders.Value() = %v, want nil", value)
+	}
+}
+
+func Test_dequeueOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		aging time.Duration
+		want  string
+	}{
+		{
+			name: "disabled",
+			want: "priority DESC, id ASC",
+		},
+		{
+			name:  "enabled",
+			aging: time.Minute,
+			want:  "priority + FLOOR(EXTRACT(EPOCH FROM NOW() - COALESCE(created_at, NOW())) * 1000 / 60000) DESC, id ASC",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dequeueOrder(tt.aging); got != tt.want {
+				t.Errorf("dequeueOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dequeueOrder_index(t *testing.T) {
+	// ready tasks are read in index order only when ordering
+	// matches columns of jobq_task_queue_priority_idx
+	const indexOrder = "priority DESC, id ASC"
+	if got := dequeueOrder(0); got != indexOrder {
+		t.Errorf("dequeueOrder() = %v, want index order %v", got, indexOrder)
+	}
+	if got := dequeueOrder(time.Minute); strings.HasPrefix(got, "priority DESC") {
+		t.Errorf("dequeueOrder() = %v, want aged priority expression", got)
+	}
+}
+
+func Test_duplicateTaskError(t *testing.T) {
+	otherErr := errors.New("test err")
+	keyErr := &pq.Error{Code: "23505", Constraint: "jobq_task_unique_key_idx"}
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "uid_violation",
+			err:  &pq.Error{Code: "23505", Constraint: "jobq_task_uid_unique"},
+			want: ErrDuplicateTask,
+		},
+		{
+			name: "other_violation",
+			err:  keyErr,
+			want: keyErr,
+		},
+		{
+			name: "other",
+			err:  otherErr,
+			want: otherErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := duplicateTaskError(tt.err); got != tt.want {
+				t.Errorf("duplicateTaskError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type errDBExecer struct {
+	err     error
+	gotStmt string
+	gotArgs []interface{}
+}
+
+func (e *errDBExecer) Exec(stmt string, args ...interface{}) (sql.Result, error) {
+	e.gotStmt = stmt
+	e.gotArgs = args
+	return nil, e.err
+}
+
+func Test_buryTask_sameUID(t *testing.T) {
+	execer := &errDBExecer{}
+	for i, lastError := range []string{"first err", "second err"} {
+		row := &TaskRow{uid: "test-uid", jobName: "test-job-name", attempts: i + 1}
+		if err := buryTask(execer, row, lastError); err != nil {
+			t.Fatalf("buryTask() error = %v", err)
+		}
+		if !strings.Contains(execer.gotStmt, "ON CONFLICT (uid) DO UPDATE SET") {
+			t.Fatalf("buryTask() stmt does not replace dead task with the same uid")
+		}
+		if execer.gotArgs[0] != "test-uid" || execer.gotArgs[5] != lastError {
+			t.Errorf("buryTask() uid = %v, last error = %v, want test-uid, %v", execer.gotArgs[0], execer.gotArgs[5], lastError)
+		}
+	}
+}
+
+func Test_requeueDeadTask(t *testing.T) {
+	otherErr := errors.New("test err")
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{
+			name:    "unique_key_violation",
+			err:     &pq.Error{Code: "23505", Constraint: "jobq_task_unique_key_idx"},
+			wantErr: ErrDuplicateTask,
+		},
+		{
+			name:    "uid_violation",
+			err:     &pq.Error{Code: "23505", Constraint: "jobq_task_uid_unique"},
+			wantErr: ErrDuplicateTask,
+		},
+		{
+			name:    "other",
+			err:     otherErr,
+			wantErr: otherErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execer := &errDBExecer{err: tt.err}
+			if _, err := requeueDeadTask(execer, "uid"); err != tt.wantErr {
+				t.Errorf("requeueDeadTask() error = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Count(execer.gotStmt, "unique_key") != 3 {
+				t.Errorf("requeueDeadTask() stmt does not restore unique key")
+			}
+		})
+	}
+}
+
+func Test_finishedAt_clockTimestamp(t *testing.T) {
+	row := &TaskRow{uid: "test-uid", jobName: "test-job-name"}
+	execer := &errDBExecer{}
+	if err := insertTaskHistory(execer, row, TaskFinished, "worker", time.Second); err != nil {
+		t.Fatalf("insertTaskHistory() error = %v", err)
+	}
+	if strings.Contains(execer.gotStmt, "NOW()") || !strings.Contains(execer.gotStmt, "clock_timestamp()") {
+		t.Errorf("insertTaskHistory() stmt = %s, want finished_at set with clock_timestamp()", execer.gotStmt)
+	}
+	if err := upsertTaskResult(execer, row, []byte(`{}`), time.Hour); err != nil {
+		t.Fatalf("upsertTaskResult() error = %v", err)
+	}
+	if strings.Contains(execer.gotStmt, "NOW()") || !strings.Contains(execer.gotStmt, "clock_timestamp()") {
+		t.Errorf("upsertTaskResult() stmt = %s, want expires_at set with clock_timestamp()", execer.gotStmt)
+	}
+}
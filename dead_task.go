@@ -0,0 +1,72 @@
+package jobq
+
+import (
+	"time"
+)
+
+// DeadTask is a task that has exhausted all of it's attempts
+// and was moved out of task queue
+type DeadTask struct {
+	row      TaskRow
+	failedAt time.Time
+}
+
+// ScanBody scans dead task body with TaskBody implementation
+func (tsk *DeadTask) ScanBody(body Scanner) error {
+	return body.Scan(tsk.row.body)
+}
+
+// ID returns dead task identifier
+func (tsk *DeadTask) ID() int64 {
+	return tsk.row.id
+}
+
+// UID returns unique identifier of the original task
+func (tsk *DeadTask) UID() string {
+	return tsk.row.uid
+}
+
+// JobName returns name of a job that failed to handle this task
+func (tsk *DeadTask) JobName() string {
+	return tsk.row.jobName
+}
+
+// Queue returns name of a queue the original task was queued to
+func (tsk *DeadTask) Queue() string {
+	return tsk.row.queue
+}
+
+// Attempts returns how many times task was attempted
+func (tsk *DeadTask) Attempts() int {
+	return tsk.row.attempts
+}
+
+// LastError returns error message of the last attempt
+func (tsk *DeadTask) LastError() string {
+	return tsk.row.lastError
+}
+
+// CreatedAt returns time when the original task was queued
+func (tsk *DeadTask) CreatedAt() time.Time {
+	return tsk.row.createdAt.Time
+}
+
+// LastAttemptedAt returns time when task was attempted for the last time
+func (tsk *DeadTask) LastAttemptedAt() time.Time {
+	return tsk.row.lastAttemptedAt.Time
+}
+
+// Header returns value of the original task header
+func (tsk *DeadTask) Header(key string) string {
+	return tsk.row.headers.Get(key)
+}
+
+// Headers returns a copy of the original task headers
+func (tsk *DeadTask) Headers() map[string]string {
+	return tsk.row.headers.copy()
+}
+
+// FailedAt returns time when task was moved to dead tasks
+func (tsk *DeadTask) FailedAt() time.Time {
+	return tsk.failedAt
+}
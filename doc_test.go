@@ -1,6 +1,7 @@
 package jobq_test
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -13,7 +14,7 @@ import (
 func ExampleManager() {
 	var conninfo string
 	manager := jobq.NewManager(conninfo)
-	manager.Run()
+	manager.Run(context.Background())
 }
 
 // This example shows how to create a new job
@@ -25,6 +26,9 @@ func ExampleJob() {
 		jobq.WithJobRequeuing(true),
 		jobq.WithJobRequeueRetries(5),
 		jobq.WithJobTimeout(time.Second * 5),
+		jobq.WithJobTTL(time.Minute),
+		jobq.WithJobMaxAttempts(20),
+		jobq.WithJobRetryPolicy(jobq.ExponentialRetryPolicy(time.Second, time.Hour, 0.5, 0)),
 	}
 	err := manager.Register(logjob.Name, logjob.New(), opts...)
 	if err != nil {
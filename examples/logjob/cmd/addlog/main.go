@@ -49,6 +49,7 @@ func main() {
 	}
 	defer tx.Rollback()
 	// add tasks
+	tasks := make([]*jobq.PreparedTask, 0, *n)
 	for i := uint(0); i < *n; i++ {
 		task, err := jobq.NewTask(logjob.Name, &logjob.TaskBody{
 			Message: strings.Join(fs.Args(), " "),
@@ -56,9 +57,10 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
-		if err = task.Queue(tx); err != nil {
-			panic(err)
-		}
+		tasks = append(tasks, task)
+	}
+	if err = jobq.QueueBatch(tx, tasks...); err != nil {
+		panic(err)
 	}
 	err = tx.Commit()
 	if err != nil {
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/dbarzdys/jobq"
 
@@ -25,7 +32,8 @@ func main() {
 		*dbName,
 		*dbPassword,
 	)
-	manager := jobq.NewManager(conninfo)
+	// running tasks are given 30 seconds to finish on Ctrl-C
+	manager := jobq.NewManager(conninfo, jobq.WithManagerDrainTimeout(30*time.Second))
 	if err := manager.Register(
 		logjob.Name,
 		logjob.New(),
@@ -33,7 +41,16 @@ func main() {
 	); err != nil {
 		panic(err)
 	}
-	if err := manager.Run(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := manager.Run(ctx)
+	var shutdownErr *jobq.ShutdownError
+	if errors.As(err, &shutdownErr) {
+		// abandoned tasks are returned to task queue
+		log.Print(shutdownErr)
+		return
+	}
+	if err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,119 @@
+package jobq
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// taskDeadline is a task context with a deadline
+// that can be extended while task is handled
+type taskDeadline struct {
+	context.Context
+	cancel   context.CancelFunc
+	ttl      time.Duration
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+	expired  bool
+}
+
+// newTaskDeadline returns context that is canceled after ttl
+// unless it's deadline is extended. Zero ttl disables deadline
+func newTaskDeadline(parent context.Context, ttl time.Duration) (*taskDeadline, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	d := &taskDeadline{
+		Context: ctx,
+		cancel:  cancel,
+		ttl:     ttl,
+	}
+	if ttl > 0 {
+		d.deadline = time.Now().Add(ttl)
+		d.timer = time.AfterFunc(ttl, d.expire)
+	}
+	return d, d.stop
+}
+
+func (d *taskDeadline) expire() {
+	d.mu.Lock()
+	d.expired = true
+	d.mu.Unlock()
+	d.cancel()
+}
+
+func (d *taskDeadline) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.cancel()
+}
+
+// Deadline returns the earlier of task and parent deadlines
+func (d *taskDeadline) Deadline() (time.Time, bool) {
+	parent, ok := d.Context.Deadline()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer == nil || (ok && parent.Before(d.deadline)) {
+		return parent, ok
+	}
+	return d.deadline, true
+}
+
+func (d *taskDeadline) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expired {
+		return context.DeadlineExceeded
+	}
+	return d.Context.Err()
+}
+
+// extend moves deadline to at least dur from now.
+// It fails if context is already done
+func (d *taskDeadline) extend(dur time.Duration) error {
+	if err := d.Err(); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer == nil {
+		return nil
+	}
+	at := time.Now().Add(dur)
+	if !at.After(d.deadline) {
+		return nil
+	}
+	if !d.timer.Stop() {
+		return context.DeadlineExceeded
+	}
+	d.deadline = at
+	d.timer.Reset(dur)
+	return nil
+}
+
+// ExtendDeadline moves deadline of task context to at least d from now.
+// Tasks of a batch share context, so it extends deadline of the whole
+// batch. Leases of leased tasks are kept while the deadline has not passed
+func (tsk *Task) ExtendDeadline(d time.Duration) error {
+	if err := validateTTL(d); err != nil {
+		return err
+	}
+	if tsk.deadline == nil {
+		return nil
+	}
+	return tsk.deadline.extend(d)
+}
+
+// Heartbeat reports that task is still being handled and extends
+// deadline of task context by task ttl. Handlers that stop sending
+// heartbeats are canceled after ttl and their leased tasks are
+// recovered by other workers once leases expire
+func (tsk *Task) Heartbeat(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tsk.deadline == nil || tsk.deadline.ttl == 0 {
+		return nil
+	}
+	return tsk.deadline.extend(tsk.deadline.ttl)
+}
@@ -0,0 +1,150 @@
+package jobq
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTask_ExtendDeadline(t *testing.T) {
+	ctx, cancel := newTaskDeadline(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	task := &Task{row: &TaskRow{}, deadline: ctx}
+	before, _ := ctx.Deadline()
+	if err := task.ExtendDeadline(time.Minute); err != nil {
+		t.Fatalf("Task.ExtendDeadline() error = %v", err)
+	}
+	after, ok := ctx.Deadline()
+	if !ok || !after.After(before) {
+		t.Errorf("Task.ExtendDeadline() deadline = %v, want after %v", after, before)
+	}
+	if err := task.ExtendDeadline(time.Millisecond); err != nil {
+		t.Fatalf("Task.ExtendDeadline() error = %v", err)
+	}
+	if got, _ := ctx.Deadline(); !got.Equal(after) {
+		t.Errorf("Task.ExtendDeadline() shortened deadline to %v", got)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Errorf("task context error = %v after deadline was extended", err)
+	}
+	if err := task.ExtendDeadline(0); err != ErrInvalidTTL {
+		t.Errorf("Task.ExtendDeadline() error = %v, want %v", err, ErrInvalidTTL)
+	}
+}
+
+func TestTask_Heartbeat(t *testing.T) {
+	ctx, cancel := newTaskDeadline(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	task := &Task{row: &TaskRow{}, deadline: ctx}
+	for i := 0; i < 4; i++ {
+		time.Sleep(25 * time.Millisecond)
+		if err := task.Heartbeat(ctx); err != nil {
+			t.Fatalf("Task.Heartbeat() error = %v", err)
+		}
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("task context was not canceled after heartbeats stopped")
+	}
+	if err := ctx.Err(); err != context.DeadlineExceeded {
+		t.Errorf("task context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := task.Heartbeat(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Task.Heartbeat() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTask_Heartbeat_noDeadline(t *testing.T) {
+	ctx, cancel := newTaskDeadline(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("task context has deadline")
+	}
+	task := &Task{row: &TaskRow{}, deadline: ctx}
+	if err := task.Heartbeat(ctx); err != nil {
+		t.Errorf("Task.Heartbeat() error = %v", err)
+	}
+	if err := task.ExtendDeadline(time.Minute); err != nil {
+		t.Errorf("Task.ExtendDeadline() error = %v", err)
+	}
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("Task.ExtendDeadline() added deadline")
+	}
+}
+
+func Test_leaseAction_alive(t *testing.T) {
+	act := newLeaseAction(&mockDB{}, "worker-1", time.Minute, []*TaskRow{{id: 1}})
+	if !act.alive() {
+		t.Errorf("leaseAction.alive() = false before tasks are handled")
+	}
+	ctx, cancel := newTaskDeadline(context.Background(), time.Minute)
+	act.keepWhile(ctx, cancel, nil)
+	if !act.alive() {
+		t.Errorf("leaseAction.alive() = false while tasks are handled")
+	}
+	cancel()
+	if act.alive() {
+		t.Errorf("leaseAction.alive() = true after task context is done")
+	}
+}
+
+func Test_leaseAction_extend(t *testing.T) {
+	tests := []struct {
+		name       string
+		affected   int64
+		wantErr    bool
+		expired    bool
+		wantReport bool
+		wantCancel bool
+	}{
+		{
+			name:     "extended",
+			affected: 2,
+		},
+		{
+			name:       "lost",
+			affected:   1,
+			wantReport: true,
+			wantCancel: true,
+		},
+		{
+			name:       "failed",
+			wantErr:    true,
+			wantReport: true,
+		},
+		{
+			name:       "failed_after_expiry",
+			wantErr:    true,
+			expired:    true,
+			wantReport: true,
+			wantCancel: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execer := &mockDBExecer{wantErr: tt.wantErr, affected: tt.affected}
+			act := newLeaseAction(&mockDB{mockDBExecer: execer}, "worker-1", time.Minute, []*TaskRow{{id: 1}, {id: 2}})
+			if tt.expired {
+				act.extended = time.Now().Add(-time.Minute)
+			}
+			var reported error
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			act.keepWhile(ctx, cancel, func(err error) {
+				reported = err
+			})
+			act.extend()
+			if (reported != nil) != tt.wantReport {
+				t.Errorf("leaseAction.extend() reported error = %v, want report %v", reported, tt.wantReport)
+			}
+			if tt.affected == 1 && reported != ErrLeaseLost {
+				t.Errorf("leaseAction.extend() reported error = %v, want %v", reported, ErrLeaseLost)
+			}
+			if (ctx.Err() != nil) != tt.wantCancel {
+				t.Errorf("leaseAction.extend() canceled = %v, want %v", ctx.Err() != nil, tt.wantCancel)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package jobq
+
+import (
+	"time"
+)
+
+// canceledHistoryRetention is how long canceled tasks are kept
+// in task history when history is disabled
+const canceledHistoryRetention = time.Hour * 24
+
+// HistoryEntry is a task that finished either by succeeding, by being
+// moved to dead tasks, by being canceled or by failing without requeue
+type HistoryEntry struct {
+	uid        string
+	jobName    string
+	queue      string
+	status     TaskState
+	attempts   int
+	worker     string
+	duration   nullDuration
+	createdAt  nullTime
+	finishedAt nullTime
+}
+
+// UID returns unique identifier of the task
+func (e *HistoryEntry) UID() string {
+	return e.uid
+}
+
+// JobName returns name of a job that handled the task
+func (e *HistoryEntry) JobName() string {
+	return e.jobName
+}
+
+// Queue returns name of a queue the task was queued to
+func (e *HistoryEntry) Queue() string {
+	return e.queue
+}
+
+// Status returns TaskFinished for succeeded tasks, TaskDead for tasks
+// moved to dead tasks, TaskCanceled for canceled tasks and TaskFailed
+// for failed tasks that were dropped without requeue
+func (e *HistoryEntry) Status() TaskState {
+	return e.status
+}
+
+// Attempts returns how many times task was attempted
+func (e *HistoryEntry) Attempts() int {
+	return e.attempts
+}
+
+// Worker returns name of a worker that handled the last attempt
+func (e *HistoryEntry) Worker() string {
+	return e.worker
+}
+
+// Duration returns how long the last attempt took
+func (e *HistoryEntry) Duration() time.Duration {
+	return e.duration.Duration
+}
+
+// CreatedAt returns time when task was queued
+func (e *HistoryEntry) CreatedAt() time.Time {
+	return e.createdAt.Time
+}
+
+// FinishedAt returns time when task finished
+func (e *HistoryEntry) FinishedAt() time.Time {
+	return e.finishedAt.Time
+}
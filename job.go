@@ -2,6 +2,8 @@ package jobq
 
 import (
 	"context"
+	"errors"
+	"fmt"
 )
 
 // Job handles tasks consumed from database.
@@ -11,5 +13,103 @@ type Job interface {
 	HandleTask(context.Context, *Task) error
 }
 
+// JobFunc is an adapter that allows
+// ordinary functions to be used as Jobs
+type JobFunc func(context.Context, *Task) error
+
+// HandleTask calls f(ctx, tsk)
+func (f JobFunc) HandleTask(ctx context.Context, tsk *Task) error {
+	return f(ctx, tsk)
+}
+
+// BatchJob handles batches of tasks consumed from database.
+// It should be registered using jobq.Manager.RegisterBatch.
+// Returned BatchError fails only tasks it contains, any other
+// error fails all tasks of the batch
+type BatchJob interface {
+	HandleTasks(context.Context, []*Task) error
+}
+
+// BatchJobFunc is an adapter that allows
+// ordinary functions to be used as BatchJobs
+type BatchJobFunc func(context.Context, []*Task) error
+
+// HandleTasks calls f(ctx, tasks)
+func (f BatchJobFunc) HandleTasks(ctx context.Context, tasks []*Task) error {
+	return f(ctx, tasks)
+}
+
+// BatchError contains errors of failed batch tasks by task uid.
+// Tasks that are not in BatchError are considered handled
+type BatchError map[string]error
+
+func (e BatchError) Error() string {
+	return fmt.Sprintf("%d tasks of batch failed", len(e))
+}
+
+// batchJob is an adapter that allows BatchJobs
+// to be registered together with Jobs
+type batchJob struct {
+	BatchJob
+}
+
+// HandleTask handles task as a batch of one task
+func (j batchJob) HandleTask(ctx context.Context, tsk *Task) error {
+	err := j.HandleTasks(ctx, []*Task{tsk})
+	var batchErr BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr[tsk.UID()]
+	}
+	return err
+}
+
+// ResultJob handles tasks and returns their results. Results are
+// stored when task succeeds and can be retrieved with Client.Result.
+// It should be registered using jobq.Manager.RegisterResult
+type ResultJob interface {
+	HandleTask(context.Context, *Task) (Valuer, error)
+}
+
+// ResultJobFunc is an adapter that allows
+// ordinary functions to be used as ResultJobs
+type ResultJobFunc func(context.Context, *Task) (Valuer, error)
+
+// HandleTask calls f(ctx, tsk)
+func (f ResultJobFunc) HandleTask(ctx context.Context, tsk *Task) (Valuer, error) {
+	return f(ctx, tsk)
+}
+
+// resultJob is an adapter that allows ResultJobs
+// to be registered and wrapped with middlewares as Jobs
+type resultJob struct {
+	job ResultJob
+}
+
+// HandleTask handles task and keeps it's result with the task
+func (j resultJob) HandleTask(ctx context.Context, tsk *Task) error {
+	result, err := j.job.HandleTask(ctx, tsk)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if result != nil {
+		if body, err = result.Value(); err != nil {
+			return err
+		}
+	}
+	tsk.result = body
+	tsk.hasResult = true
+	return nil
+}
+
 // JobMiddleware is used to wrap Jobs with middlewares
 type JobMiddleware func(Job) Job
+
+// wrapJob wraps job with middlewares. First middleware
+// is the outermost one and is called first.
+func wrapJob(job Job, mws ...JobMiddleware) Job {
+	for i := len(mws) - 1; i >= 0; i-- {
+		job = mws[i](job)
+	}
+	return job
+}
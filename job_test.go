@@ -1,6 +1,11 @@
 package jobq
 
-import "context"
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
 
 type mockJob struct {
 	onHandleTask func(context.Context, *Task) error
@@ -9,3 +14,69 @@ type mockJob struct {
 func (j mockJob) HandleTask(ctx context.Context, t *Task) error {
 	return j.onHandleTask(ctx, t)
 }
+
+func Test_wrapJob(t *testing.T) {
+	var calls []string
+	mw := func(name string) JobMiddleware {
+		return func(next Job) Job {
+			return JobFunc(func(ctx context.Context, tsk *Task) error {
+				calls = append(calls, name)
+				return next.HandleTask(ctx, tsk)
+			})
+		}
+	}
+	job := &mockJob{
+		onHandleTask: func(context.Context, *Task) error {
+			calls = append(calls, "job")
+			return nil
+		},
+	}
+	wrapped := wrapJob(job, mw("first"), mw("second"), mw("third"))
+	if err := wrapped.HandleTask(context.Background(), &Task{}); err != nil {
+		t.Errorf("wrapJob() HandleTask() error = %v", err)
+	}
+	want := []string{"first", "second", "third", "job"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("wrapJob() calls = %v, want %v", calls, want)
+	}
+}
+
+func Test_batchJob_HandleTask(t *testing.T) {
+	errTask := errors.New("test err")
+	job := batchJob{BatchJobFunc(func(ctx context.Context, tasks []*Task) error {
+		return BatchError{tasks[0].UID(): errTask}
+	})}
+	err := job.HandleTask(context.Background(), &Task{row: &TaskRow{uid: "a"}})
+	if err != errTask {
+		t.Errorf("batchJob.HandleTask() error = %v, want %v", err, errTask)
+	}
+}
+
+type mockBody struct {
+	value []byte
+}
+
+func (b mockBody) Value() ([]byte, error) {
+	return b.value, nil
+}
+
+func Test_resultJob_HandleTask(t *testing.T) {
+	job := resultJob{ResultJobFunc(func(ctx context.Context, tsk *Task) (Valuer, error) {
+		return mockBody{[]byte(`{"rows":42}`)}, nil
+	})}
+	task := &Task{row: &TaskRow{}}
+	if err := job.HandleTask(context.Background(), task); err != nil {
+		t.Fatalf("resultJob.HandleTask() error = %v", err)
+	}
+	if !task.hasResult || string(task.result) != `{"rows":42}` {
+		t.Errorf("resultJob.HandleTask() result = %s, want %s", task.result, `{"rows":42}`)
+	}
+	errTask := errors.New("test err")
+	job = resultJob{ResultJobFunc(func(ctx context.Context, tsk *Task) (Valuer, error) {
+		return nil, errTask
+	})}
+	task = &Task{row: &TaskRow{}}
+	if err := job.HandleTask(context.Background(), task); err != errTask || task.hasResult {
+		t.Errorf("resultJob.HandleTask() error = %v, want %v", err, errTask)
+	}
+}
@@ -1,27 +1,54 @@
 package jobq
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/lib/pq"
 )
 
+var errListenerClosed = errors.New("listener notification channel closed")
+
 type event struct {
 	JobName string   `json:"job_name"`
+	Queue   string   `json:"queue"`
+	Count   int      `json:"count"`
 	Timeout nullTime `json:"timeout"`
 	StartAt nullTime `json:"start_at"`
 }
 
+// count returns number of created tasks.
+// Notifications sent before batches were added are sent per task
+func (ev *event) count() int {
+	if ev.Count < 1 {
+		return 1
+	}
+	return ev.Count
+}
+
+// queue returns queue of created task.
+// Notifications sent before queues were added have job name only
+func (ev *event) queue() string {
+	if ev.Queue == "" {
+		return ev.JobName
+	}
+	return ev.Queue
+}
+
 type listenerOpts struct {
 	minReconnectInterval time.Duration
 	maxReconnectInterval time.Duration
 	aliveCheckInterval   time.Duration
 	callback             pq.EventCallbackType
+	onError              func(error)
+	logger               Logger
 }
 
 type listener struct {
 	events   chan *event
+	cancels  chan string
 	conninfo string
 	listenerOpts
 	dbListener *pq.Listener
@@ -31,41 +58,115 @@ func (l *listener) connect() error {
 	l.dbListener = pq.NewListener(l.conninfo,
 		l.minReconnectInterval,
 		l.maxReconnectInterval,
-		l.callback,
+		l.onEvent,
 	)
-	return l.dbListener.Listen("jobq_task_created")
+	if err := l.dbListener.Listen("jobq_task_created"); err != nil {
+		return err
+	}
+	return l.dbListener.Listen("jobq_task_canceled")
+}
+
+// onEvent logs reconnects of database listener
+// and passes events to callback
+func (l *listener) onEvent(ev pq.ListenerEventType, err error) {
+	if ev == pq.ListenerEventReconnected {
+		l.log().Info("listener reconnected")
+	}
+	if l.callback != nil {
+		l.callback(ev, err)
+	}
 }
-func (l *listener) listen() error {
-	err := l.connect()
-	if err != nil {
-		time.Sleep(time.Second)
-		return l.listen()
+
+func (l *listener) close() {
+	if l.dbListener == nil {
+		return
 	}
+	l.dbListener.Close()
+	l.dbListener = nil
+}
+
+// listen receives events until ctx is done.
+// Connection errors are reported and listener reconnects
+func (l *listener) listen(ctx context.Context) error {
+	defer l.close()
+	reconnecting := false
 	for {
+		err := l.connect()
+		if err == nil {
+			if reconnecting {
+				l.log().Info("listener reconnected")
+			}
+			err = l.receive(ctx)
+		}
+		reconnecting = true
+		l.close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		l.handleError(err)
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.minReconnectInterval):
+		}
+	}
+}
+
+func (l *listener) receive(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case ev, ok := <-l.dbListener.Notify:
 			if !ok {
-				return l.listen()
+				return errListenerClosed
 			}
 			if ev == nil {
 				continue
 			}
-			body := []byte(ev.Extra)
+			if ev.Channel == "jobq_task_canceled" {
+				select {
+				case l.cancels <- ev.Extra:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				continue
+			}
 			e := new(event)
-			json.Unmarshal(body, e)
-			l.events <- e
+			if err := json.Unmarshal([]byte(ev.Extra), e); err != nil {
+				l.handleError(err)
+				continue
+			}
+			select {
+			case l.events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		case <-time.After(l.aliveCheckInterval):
-			err = l.dbListener.Ping()
-			if err != nil {
-				return l.listen()
+			if err := l.dbListener.Ping(); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+func (l *listener) handleError(err error) {
+	if l.onError != nil {
+		l.onError(err)
+	}
+}
+
+func (l *listener) log() Logger {
+	if l.logger == nil {
+		return nopLogger{}
+	}
+	return l.logger
+}
+
 func makeListener(conninfo string, opts listenerOpts) *listener {
 	return &listener{
 		events:       make(chan *event),
+		cancels:      make(chan string),
 		listenerOpts: opts,
 		conninfo:     conninfo,
 	}
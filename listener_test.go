@@ -3,6 +3,8 @@ package jobq
 import (
 	"reflect"
 	"testing"
+
+	"github.com/lib/pq"
 )
 
 func Test_makeListener(t *testing.T) {
@@ -20,6 +22,9 @@ func Test_makeListener(t *testing.T) {
 	if got.events == nil {
 		t.Error("makeListener(); got.events == nil")
 	}
+	if got.cancels == nil {
+		t.Error("makeListener(); got.cancels == nil")
+	}
 	if !reflect.DeepEqual(got.listenerOpts, opts) {
 		t.Errorf("makeListener(); got.listenerOpts %v, want %v", got.listenerOpts, opts)
 	}
@@ -27,3 +32,34 @@ func Test_makeListener(t *testing.T) {
 		t.Errorf("makeListener(); got.conninfo %s, want %s", got.conninfo, conninfo)
 	}
 }
+
+func Test_listener_onEvent(t *testing.T) {
+	logger := new(mockLogger)
+	var got []pq.ListenerEventType
+	l := makeListener("test conninfo", listenerOpts{
+		callback: func(ev pq.ListenerEventType, _ error) {
+			got = append(got, ev)
+		},
+		logger: logger,
+	})
+	l.onEvent(pq.ListenerEventConnected, nil)
+	l.onEvent(pq.ListenerEventReconnected, nil)
+	want := []pq.ListenerEventType{pq.ListenerEventConnected, pq.ListenerEventReconnected}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listener.onEvent() callback events = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(logger.events, []string{"listener reconnected"}) {
+		t.Errorf("listener.onEvent() logged %v, want [listener reconnected]", logger.events)
+	}
+}
+
+func Test_event(t *testing.T) {
+	ev := &event{JobName: "send_email"}
+	if ev.count() != 1 || ev.queue() != "send_email" {
+		t.Errorf("event count = %v, queue = %v, want 1, send_email", ev.count(), ev.queue())
+	}
+	ev = &event{JobName: "send_email", Queue: "critical", Count: 10}
+	if ev.count() != 10 || ev.queue() != "critical" {
+		t.Errorf("event count = %v, queue = %v, want 10, critical", ev.count(), ev.queue())
+	}
+}
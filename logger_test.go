@@ -0,0 +1,23 @@
+package jobq
+
+import (
+	"sync"
+)
+
+type mockLogger struct {
+	events []string
+	fields [][]interface{}
+	sync.Mutex
+}
+
+func (l *mockLogger) log(msg string, args []interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	l.events = append(l.events, msg)
+	l.fields = append(l.fields, args)
+}
+
+func (l *mockLogger) Debug(msg string, args ...interface{}) { l.log(msg, args) }
+func (l *mockLogger) Info(msg string, args ...interface{})  { l.log(msg, args) }
+func (l *mockLogger) Warn(msg string, args ...interface{})  { l.log(msg, args) }
+func (l *mockLogger) Error(msg string, args ...interface{}) { l.log(msg, args) }
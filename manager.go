@@ -1,7 +1,10 @@
 package jobq
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dbarzdys/jobq/migrate"
@@ -12,21 +15,71 @@ import (
 // Manager manages jobs and workers
 type Manager struct {
 	conninfo string
-	store    Store
+	store    managerStore
 	listener *listener
-	pools    map[string]WorkerPool
+	pools    map[string]*workerPool
 	jobs     map[string]Job
 	opts     map[string]JobOptions
-	stopch   chan bool
+	queues   map[string]QueueOptions
+	// schedules queue tasks of recurring jobs
+	schedules map[string]*schedule
+	// subscribers are worker pools subscribed to a queue
+	subscribers map[string][]*workerPool
+	// depths are last reported queue depths by queue and job
+	depths  map[string]map[string]int
+	mws     []JobMiddleware
+	options ManagerOptions
+	cancel  context.CancelFunc
+	stopch  chan context.Context
+	donech  chan ShutdownStats
+	exitch  chan struct{}
+	mu      sync.Mutex
+	// err is an invalid option error returned by Run
+	err error
 }
 
-// NewManager creates a new Manager using conninfo for database connection
-func NewManager(conninfo string) *Manager {
+// ShutdownStats are counters of tasks that were running
+// when Manager started shutting down
+type ShutdownStats struct {
+	// Drained is a number of tasks that finished during shutdown
+	Drained int
+	// Abandoned is a number of tasks that were canceled
+	// and returned to task queue
+	Abandoned int
+}
+
+// err returns *ShutdownError if any task was abandoned
+func (s ShutdownStats) err() error {
+	if s.Abandoned == 0 {
+		return nil
+	}
+	return &ShutdownError{s}
+}
+
+// ShutdownError is returned by Manager.Shutdown when context
+// is done before all running tasks have finished and by Manager.Run
+// when it's context is done while tasks are running
+type ShutdownError struct {
+	ShutdownStats
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("shutdown: %d tasks drained, %d tasks abandoned", e.Drained, e.Abandoned)
+}
+
+// NewManager creates a new Manager using conninfo for database connection.
+// Invalid option error is returned by Manager.Run
+func NewManager(conninfo string, opts ...ManagerOption) *Manager {
+	options, err := defaultManagerOptions.with(opts...)
 	return &Manager{
-		conninfo: conninfo,
-		jobs:     make(map[string]Job),
-		pools:    make(map[string]WorkerPool),
-		opts:     make(map[string]JobOptions),
+		conninfo:  conninfo,
+		jobs:      make(map[string]Job),
+		pools:     make(map[string]*workerPool),
+		opts:      make(map[string]JobOptions),
+		queues:    make(map[string]QueueOptions),
+		schedules: make(map[string]*schedule),
+		options:   options,
+		err:       err,
 	}
 }
 
@@ -47,55 +100,277 @@ func (m *Manager) Register(name string, job Job, opts ...JobOption) error {
 	return nil
 }
 
-// Close stops all workers and closes connection to database
+// RegisterBatch adds a new job that handles tasks in batches of
+// up to WithJobBatchSize tasks. Middlewares wrap a single task, so
+// WithJobMiddleware is rejected and Manager middlewares added
+// with Use are not applied to batch jobs
+func (m *Manager) RegisterBatch(name string, job BatchJob, opts ...JobOption) error {
+	if job == nil {
+		return ErrInvalidJob
+	}
+	options, err := defaultJobOptions.with(opts...)
+	if err != nil {
+		return err
+	}
+	if len(options.middlewares) > 0 {
+		return ErrBatchJobMiddleware
+	}
+	return m.Register(name, batchJob{job}, opts...)
+}
+
+// RegisterResult adds a new job which results are stored
+// and can be retrieved with Client.Result
+func (m *Manager) RegisterResult(name string, job ResultJob, opts ...JobOption) error {
+	if job == nil {
+		return ErrInvalidJob
+	}
+	return m.Register(name, resultJob{job}, opts...)
+}
+
+// RegisterQueue adds a queue with it's own worker pool. Queue workers
+// handle tasks of all registered jobs queued to the queue or to the queues
+// it is subscribed to. Jobs that are not handled by registered queues
+// are handled by workers of an implicit queue named after the job
+func (m *Manager) RegisterQueue(name string, opts ...QueueOption) error {
+	if err := firstError(
+		validateQueueName(name),
+		validateIfQueueUnregistered(name, m.queues),
+	); err != nil {
+		return err
+	}
+	options, err := defaultQueueOptions.with(opts...)
+	if err != nil {
+		return err
+	}
+	m.queues[name] = options
+	return nil
+}
+
+// Schedule queues a task of a job with body returned by body factory
+// at every run of a cron spec, e.g. "*/15 * * * *" or "@daily".
+// Schedules are stored, so that runs missed while no manager was
+// running could be caught up. Managers take turns using an advisory
+// lock, so each run is queued once across all managers. Job does not
+// have to be registered with this manager
+func (m *Manager) Schedule(name, cronSpec, jobName string, body BodyFactory, opts ...ScheduleOption) error {
+	if err := firstError(
+		validateScheduleName(name),
+		validateIfScheduleUnregistered(name, m.schedules),
+		validateJobName(jobName),
+		validateBodyFactory(body),
+	); err != nil {
+		return err
+	}
+	cron, err := parseCron(cronSpec)
+	if err != nil {
+		return err
+	}
+	options, err := defaultScheduleOptions.with(opts...)
+	if err != nil {
+		return err
+	}
+	s := &schedule{
+		name:    name,
+		spec:    cronSpec,
+		cron:    cron,
+		jobName: jobName,
+		body:    body,
+		opts:    options,
+	}
+	if s.next(time.Now()).IsZero() {
+		return ErrInvalidCronSpec
+	}
+	m.schedules[name] = s
+	return nil
+}
+
+// Use appends middlewares that will wrap every registered job
+// except batch jobs. Manager middlewares are applied before job
+// middlewares and are called in the same order as they were added
+func (m *Manager) Use(mws ...JobMiddleware) error {
+	for _, mw := range mws {
+		if err := validateJobMiddleware(mw); err != nil {
+			return err
+		}
+	}
+	m.mws = append(m.mws, mws...)
+	return nil
+}
+
+// Close stops all workers and waits for running tasks to finish
 func (m *Manager) Close() (err error) {
-	if m.stopch == nil {
-		return
+	_, err = m.Shutdown(context.Background())
+	return err
+}
+
+// Shutdown stops workers from taking new tasks, waits for running
+// tasks to finish and returns how many of them were drained.
+// When ctx is done, running tasks are canceled and returned
+// to task queue and *ShutdownError is returned as well
+func (m *Manager) Shutdown(ctx context.Context) (ShutdownStats, error) {
+	m.mu.Lock()
+	stopch, donech, exitch := m.stopch, m.donech, m.exitch
+	m.mu.Unlock()
+	if stopch == nil {
+		return ShutdownStats{}, nil
+	}
+	select {
+	case stopch <- ctx:
+		stats := <-donech
+		return stats, stats.err()
+	case <-exitch:
+		return ShutdownStats{}, nil
+	}
+}
+
+// DeadTasks returns dead tasks of a job ordered from the newest.
+// Empty jobName returns dead tasks of all jobs
+func (m *Manager) DeadTasks(jobName string, limit, offset int) ([]*DeadTask, error) {
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	return m.store.DeadTasks(jobName, limit, offset)
+}
+
+// DeadTask returns dead task by it's unique identifier
+func (m *Manager) DeadTask(uid string) (*DeadTask, error) {
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	return m.store.DeadTask(uid)
+}
+
+// RequeueDeadTask moves dead task back to task queue
+// with attempts counter reset. ErrDuplicateTask is returned
+// if a task with the same unique key is pending or running
+func (m *Manager) RequeueDeadTask(uid string) error {
+	if err := m.connect(); err != nil {
+		return err
+	}
+	return m.store.RequeueDeadTask(uid)
+}
+
+// PurgeDeadTasks deletes dead tasks of a job that failed before
+// given time and returns how many were deleted.
+// Empty jobName purges dead tasks of all jobs
+func (m *Manager) PurgeDeadTasks(jobName string, before time.Time) (int64, error) {
+	if err := m.connect(); err != nil {
+		return 0, err
 	}
-	m.stopch <- true
-	<-m.stopch
-	return
+	return m.store.PurgeDeadTasks(jobName, before)
 }
 
-// Run will connect to database and will start all workers
-func (m *Manager) Run() (err error) {
-	if err = m.setupDB(); err != nil {
+// Run will connect to database and will start all workers.
+// It blocks until ctx is done or Shutdown is called. When ctx is
+// done, running tasks are waited for up to drain timeout set with
+// WithManagerDrainTimeout. Tasks still running after it are canceled
+// and returned to task queue and *ShutdownError is returned
+func (m *Manager) Run(ctx context.Context) (err error) {
+	if m.err != nil {
+		return m.err
+	}
+	if err = m.connect(); err != nil {
 		return err
 	}
-	m.setupWorkerPools()
+	if err = m.saveSchedules(); err != nil {
+		return err
+	}
+	workCtx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.setupWorkerPools(workCtx)
 	m.setupListener()
-	// create stop channel
-	m.stopch = make(chan bool)
-	// create error channel
-	errch := make(chan error)
+	// create stop channels
+	stopch, donech := make(chan context.Context), make(chan ShutdownStats)
+	m.mu.Lock()
+	m.stopch, m.donech = stopch, donech
+	m.exitch = make(chan struct{})
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.stopch = nil
+		close(m.exitch)
+		m.mu.Unlock()
+	}()
+	// start listener
+	listenCtx, stopListening := context.WithCancel(context.Background())
+	listening := make(chan struct{})
+	go func() {
+		m.listener.listen(listenCtx)
+		close(listening)
+	}()
+	defer func() {
+		stopListening()
+		<-listening
+	}()
 	go func() {
 		for _, p := range m.pools {
 			p.Start()
 		}
 	}()
-	go func(ch chan<- error) {
-		ch <- m.listener.listen()
-	}(errch)
+	// start queue depth reporting
+	var depth <-chan time.Time
+	if _, ok := m.options.metrics.(nopMetrics); !ok {
+		ticker := time.NewTicker(queueDepthInterval)
+		defer ticker.Stop()
+		depth = ticker.C
+	}
+	// start lease reaper
+	var reap <-chan time.Time
+	if interval := m.reapInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		reap = ticker.C
+	}
+	// start schedules
+	if len(m.schedules) > 0 {
+		scheduleCtx, stopSchedules := context.WithCancel(context.Background())
+		scheduling := make(chan struct{})
+		go func() {
+			m.runScheduler(scheduleCtx)
+			close(scheduling)
+		}()
+		defer func() {
+			stopSchedules()
+			<-scheduling
+		}()
+	}
+	// start result, progress and history purging
+	purge := time.NewTicker(time.Minute)
+	defer purge.Stop()
 	for {
 		select {
+		// context done
+		case <-ctx.Done():
+			drainCtx, cancelDrain := context.WithTimeout(context.Background(), m.options.drainTimeout)
+			defer cancelDrain()
+			return m.drain(drainCtx).err()
 		// stop
-		case <-m.stopch:
-			for _, p := range m.pools {
-				p.Stop()
-			}
-			m.stopch <- true
-			m.stopch = nil
-			return
-		// error
-		case err = <-errch:
-			go m.Close()
-			return
+		case stopCtx := <-stopch:
+			donech <- m.drain(stopCtx)
+			return nil
 		// event received
 		case ev := <-m.listener.events:
-			pool, ok := m.pools[ev.JobName]
-			if ok {
-				pool.Resume(1)
+			for _, pool := range m.subscribers[ev.queue()] {
+				pool.Resume(ev.count())
 			}
+		// queue depths reported
+		case <-depth:
+			m.reportQueueDepths()
+		// task canceled
+		case uid := <-m.listener.cancels:
+			for _, p := range m.pools {
+				p.Cancel(uid)
+			}
+		// leases checked
+		case <-reap:
+			m.reapLeases()
+		// results, progress, cancels and history checked
+		case <-purge.C:
+			m.purgeResults()
+			m.purgeProgress()
+			m.purgeCancels()
+			m.purgeHistory()
+			m.warnStrandedTasks()
 		case <-time.After(time.Second * 5):
 			for _, p := range m.pools {
 				p.Resume(1)
@@ -104,38 +379,374 @@ func (m *Manager) Run() (err error) {
 	}
 }
 
+// queueDepthInterval is how often queue depths are reported to metrics
+const queueDepthInterval = 15 * time.Second
+
+// reportQueueDepths reports number of tasks of registered jobs in
+// subscribed queues. Queues that were emptied are reported as zero
+func (m *Manager) reportQueueDepths() {
+	queues := make([]string, 0, len(m.subscribers))
+	for queue := range m.subscribers {
+		queues = append(queues, queue)
+	}
+	depths, err := m.store.QueueDepths(queues)
+	if err != nil {
+		m.handleError(fmt.Errorf("queue depths: %w", err))
+		return
+	}
+	for queue, jobs := range m.depths {
+		for jobName := range jobs {
+			if _, ok := depths[queue][jobName]; !ok {
+				m.options.metrics.QueueDepth(queue, jobName, 0)
+			}
+		}
+	}
+	for queue, jobs := range depths {
+		for jobName, n := range jobs {
+			if _, ok := m.jobs[jobName]; !ok {
+				delete(jobs, jobName)
+				continue
+			}
+			m.options.metrics.QueueDepth(queue, jobName, n)
+		}
+	}
+	m.depths = depths
+}
+
+// strandedTaskAge is how long ready tasks wait in queues
+// that are not subscribed before they are reported
+const strandedTaskAge = 5 * time.Minute
+
+// warnStrandedTasks logs ready tasks of registered jobs that wait in
+// queues this manager does not subscribe to, since they are not taken
+// by it's workers and may not be taken by any other manager
+func (m *Manager) warnStrandedTasks() {
+	jobNames := make([]string, 0, len(m.jobs))
+	for name := range m.jobs {
+		jobNames = append(jobNames, name)
+	}
+	queues := make([]string, 0, len(m.subscribers))
+	for queue := range m.subscribers {
+		queues = append(queues, queue)
+	}
+	if len(jobNames) == 0 {
+		return
+	}
+	stranded, err := m.store.StrandedTasks(jobNames, queues, strandedTaskAge)
+	if err != nil {
+		m.handleError(fmt.Errorf("stranded tasks: %w", err))
+		return
+	}
+	for queue, jobs := range stranded {
+		for jobName, n := range jobs {
+			m.options.logger.Warn("tasks wait in unsubscribed queue", "queue", queue, "job", jobName, "count", n)
+		}
+	}
+}
+
+// reapInterval returns the shortest lease of registered
+// queues or zero if none of the queues lease tasks
+func (m *Manager) reapInterval() time.Duration {
+	var interval time.Duration
+	for _, opts := range m.queues {
+		if opts.lease > 0 && (interval == 0 || opts.lease < interval) {
+			interval = opts.lease
+		}
+	}
+	return interval
+}
+
+// reapLeases returns tasks of expired leases to their
+// queues and resumes workers subscribed to them
+func (m *Manager) reapLeases() {
+	reaped, err := m.store.ReapLeases()
+	if err != nil {
+		m.handleError(fmt.Errorf("reap leases: %w", err))
+		return
+	}
+	for queue, n := range reaped {
+		m.options.logger.Warn("task leases expired", "queue", queue, "count", n)
+		for _, pool := range m.subscribers[queue] {
+			pool.Resume(n)
+		}
+	}
+}
+
+// saveSchedules stores registered schedules
+func (m *Manager) saveSchedules() error {
+	now := time.Now()
+	for _, s := range m.schedules {
+		if err := m.store.SaveSchedule(s.row(now)); err != nil {
+			return fmt.Errorf("save schedule %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// runScheduler checks schedules every schedule interval until ctx is
+// done. It runs apart from Run loop, since body factories may be slow
+func (m *Manager) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	m.runSchedules()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.runSchedules()
+		}
+	}
+}
+
+// runSchedules queues tasks of schedule runs that are due before the next
+// check. Runs late by more than check interval are missed. Schedules
+// are skipped if another manager runs them. Failed schedule is reported
+// and retried on the next check without failing other schedules
+func (m *Manager) runSchedules() {
+	names := make([]string, 0, len(m.schedules))
+	for name := range m.schedules {
+		names = append(names, name)
+	}
+	now := time.Now()
+	act, err := m.store.ClaimSchedules(names, now.Add(scheduleLookahead))
+	if err == ErrNoDueSchedules {
+		return
+	}
+	if err != nil {
+		m.handleError(fmt.Errorf("run schedules: %w", err))
+		return
+	}
+	defer act.Rollback()
+	queued := make(map[*schedule][]time.Time)
+	for _, row := range act.Rows() {
+		s := m.schedules[row.name]
+		var runs []time.Time
+		err := act.Savepoint(func() (err error) {
+			runs, err = s.queue(act, row, now.Add(-scheduleInterval), now.Add(scheduleLookahead))
+			return err
+		})
+		if err != nil {
+			m.handleError(fmt.Errorf("run schedule %s: %w", s.name, err))
+			continue
+		}
+		queued[s] = runs
+	}
+	if err = act.Commit(); err != nil {
+		m.handleError(fmt.Errorf("run schedules: %w", err))
+		return
+	}
+	for s, runs := range queued {
+		for _, runAt := range runs {
+			m.options.logger.Info("scheduled task queued", "schedule", s.name, "job", s.jobName, "run_at", runAt)
+		}
+	}
+}
+
+// purgeResults deletes results kept longer than their retention
+func (m *Manager) purgeResults() {
+	n, err := m.store.PurgeResults()
+	if err != nil {
+		m.handleError(fmt.Errorf("purge results: %w", err))
+		return
+	}
+	if n > 0 {
+		m.options.logger.Debug("task results purged", "count", n)
+	}
+}
+
+// purgeProgress deletes progress of tasks that left the queue
+func (m *Manager) purgeProgress() {
+	n, err := m.store.PurgeProgress(time.Now().Add(-progressRetention))
+	if err != nil {
+		m.handleError(fmt.Errorf("purge progress: %w", err))
+		return
+	}
+	if n > 0 {
+		m.options.logger.Debug("task progress purged", "count", n)
+	}
+}
+
+// purgeCancels deletes cancel requests of tasks that left the queue.
+// They are kept as long as progress, so that Client.Cancel could tell
+// tasks that finished before they were canceled
+func (m *Manager) purgeCancels() {
+	n, err := m.store.PurgeCancels(time.Now().Add(-progressRetention))
+	if err != nil {
+		m.handleError(fmt.Errorf("purge cancels: %w", err))
+		return
+	}
+	if n > 0 {
+		m.options.logger.Debug("task cancels purged", "count", n)
+	}
+}
+
+// purgeHistory deletes history entries older than history retention.
+// Canceled tasks are kept in history even if it's disabled, so then
+// they are deleted after canceledHistoryRetention
+func (m *Manager) purgeHistory() {
+	var (
+		n   int64
+		err error
+	)
+	switch {
+	case !m.options.history:
+		n, err = m.store.PurgeCanceledHistory(time.Now().Add(-canceledHistoryRetention))
+	case m.options.historyRetention == 0:
+		return
+	default:
+		n, err = m.store.PurgeHistory(time.Now().Add(-m.options.historyRetention))
+	}
+	if err != nil {
+		m.handleError(fmt.Errorf("purge history: %w", err))
+		return
+	}
+	if n > 0 {
+		m.options.logger.Debug("task history purged", "count", n)
+	}
+}
+
+// drain stops all worker pools waiting for running tasks
+// until ctx is done and then cancels remaining tasks
+func (m *Manager) drain(ctx context.Context) ShutdownStats {
+	before := WorkerStats{}
+	for _, p := range m.pools {
+		p.Pause()
+		before = before.add(p.Stats())
+	}
+	stopped := make(chan struct{})
+	go func() {
+		for _, p := range m.pools {
+			p.Stop()
+		}
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		m.cancel()
+		<-stopped
+	}
+	m.cancel()
+	after := WorkerStats{}
+	for _, p := range m.pools {
+		after = after.add(p.Stats())
+	}
+	return ShutdownStats{
+		Drained:   after.Handled - before.Handled,
+		Abandoned: after.Abandoned - before.Abandoned,
+	}
+}
+
 func (m *Manager) setupListener() {
 	m.listener = makeListener(m.conninfo, listenerOpts{
 		aliveCheckInterval:   time.Second * 60,
 		minReconnectInterval: 10 * time.Second,
 		maxReconnectInterval: time.Minute,
 		callback: func(ev pq.ListenerEventType, err error) {
-			// TODO:
+			if err != nil {
+				m.handleError(fmt.Errorf("listener: %w", err))
+			}
+		},
+		onError: func(err error) {
+			m.handleError(fmt.Errorf("listener: %w", err))
 		},
+		logger: m.options.logger,
 	})
 }
+
+// connect sets up database connection once
+func (m *Manager) connect() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.store != nil {
+		return nil
+	}
+	return m.setupDB()
+}
+
 func (m *Manager) setupDB() error {
 	db, err := sql.Open("postgres", m.conninfo)
 	if err != nil {
 		return err
 	}
-	err = migrate.Migrate(db)
+	err = migrate.MigrateWithCallback(db, func(id int) {
+		m.options.logger.Info("migration applied", "migration_id", id)
+	})
 	if err != nil {
 		return err
 	}
-	m.store = &store{db}
+	m.store = &store{
+		db:            db,
+		priorityAging: m.options.priorityAging,
+	}
 	return nil
 }
 
-func (m *Manager) setupWorkerPools() {
-	for name, job := range m.jobs {
-		opts := m.opts[name]
-		factory := NewWorkerFactory().
-			WithStore(m.store).
-			WithJob(name, job).
-			WithOptions(opts)
-		pool := NewWorkerPool(factory)
-		pool.Scale(opts.workerPoolSize)
-		m.pools[name] = pool
+func (m *Manager) setupWorkerPools(ctx context.Context) {
+	m.subscribers = make(map[string][]*workerPool)
+	for name, opts := range m.queues {
+		subs := opts.subscriptions
+		if len(subs) == 0 {
+			subs = []QueueSubscription{{Queue: name, Weight: 1}}
+		}
+		factory := m.workerFactory(ctx).withQueue(name, subs...).withLease(opts.lease)
+		for jobName := range m.jobs {
+			m.addJob(factory, jobName)
+		}
+		m.addPool(name, factory, opts.workerPoolSize, subs)
+	}
+	// jobs that are not handled by registered queues
+	// get implicit queue named after the job
+	for name := range m.jobs {
+		if len(m.subscribers[name]) > 0 {
+			continue
+		}
+		if _, ok := m.queues[name]; ok {
+			continue
+		}
+		factory := m.workerFactory(ctx).withQueue(name)
+		m.addJob(factory, name)
+		m.addPool(name, factory, m.opts[name].workerPoolSize, []QueueSubscription{{Queue: name, Weight: 1}})
+	}
+}
+
+func (m *Manager) workerFactory(ctx context.Context) *workerFactory {
+	return newWorkerFactory().
+		withContext(ctx).
+		withErrorHandler(m.handleError).
+		withLogger(m.options.logger).
+		withMetrics(m.options.metrics).
+		withTracing(m.options.propagator, m.options.tracer).
+		withHistory(m.options.history).
+		withStore(m.store)
+}
+
+// addJob adds job wrapped with manager and job middlewares to factory.
+// Batch jobs are added as they are
+func (m *Manager) addJob(factory *workerFactory, name string) {
+	opts := m.opts[name]
+	if job, ok := m.jobs[name].(batchJob); ok {
+		factory.withBatchJob(name, job.BatchJob, opts)
+		return
+	}
+	mws := make([]JobMiddleware, 0, len(m.mws)+len(opts.middlewares))
+	mws = append(mws, m.mws...)
+	mws = append(mws, opts.middlewares...)
+	factory.withJob(name, wrapJob(m.jobs[name], mws...), opts)
+}
+
+func (m *Manager) addPool(name string, factory WorkerFactory, size int, subs []QueueSubscription) {
+	pool := newWorkerPool(factory)
+	pool.Scale(size)
+	m.pools[name] = pool
+	for _, sub := range subs {
+		m.subscribers[sub.Queue] = append(m.subscribers[sub.Queue], pool)
+	}
+}
+
+func (m *Manager) handleError(err error) {
+	if m.options.errorHandler != nil {
+		m.options.errorHandler(err)
 	}
 }
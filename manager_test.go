@@ -0,0 +1,386 @@
+package jobq
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManager_RunInvalidOption(t *testing.T) {
+	m := NewManager("", WithManagerLogger(nil))
+	if err := m.Run(context.Background()); err != ErrInvalidLogger {
+		t.Errorf("Manager.Run() error = %v, want %v", err, ErrInvalidLogger)
+	}
+}
+
+func TestManager_reportQueueDepths(t *testing.T) {
+	metrics := new(mockMetrics)
+	m := NewManager("", WithManagerMetrics(metrics))
+	if err := m.Register("send_email", &mockJob{}); err != nil {
+		t.Fatalf("Manager.Register() error = %v", err)
+	}
+	m.subscribers = map[string][]*workerPool{"send_email": nil}
+	depths := map[string]map[string]int{
+		"send_email": {"send_email": 3, "unregistered": 2},
+	}
+	m.store = &mockStore{
+		onQueueDepths: func(queues []string) (map[string]map[string]int, error) {
+			if len(queues) != 1 || queues[0] != "send_email" {
+				t.Errorf("Store.QueueDepths() queues = %v, want [send_email]", queues)
+			}
+			return depths, nil
+		},
+	}
+	m.reportQueueDepths()
+	if len(metrics.calls) != 1 {
+		t.Errorf("Manager.reportQueueDepths() recorded %v, want 1 depth", metrics.calls)
+	}
+	// emptied queue is reported once as zero
+	depths = map[string]map[string]int{}
+	m.reportQueueDepths()
+	m.reportQueueDepths()
+	if len(metrics.calls) != 2 {
+		t.Errorf("Manager.reportQueueDepths() recorded %v, want 2 depths", metrics.calls)
+	}
+}
+
+func TestManager_warnStrandedTasks(t *testing.T) {
+	logger := new(mockLogger)
+	m := NewManager("", WithManagerLogger(logger))
+	if err := m.Register("send_email", &mockJob{}); err != nil {
+		t.Fatalf("Manager.Register() error = %v", err)
+	}
+	m.subscribers = map[string][]*workerPool{"send_email": nil}
+	m.store = &mockStore{
+		onStrandedTasks: func(jobNames, queues []string, age time.Duration) (map[string]map[string]int, error) {
+			if !reflect.DeepEqual(jobNames, []string{"send_email"}) || !reflect.DeepEqual(queues, []string{"send_email"}) {
+				t.Errorf("Store.StrandedTasks() jobNames = %v, queues = %v", jobNames, queues)
+			}
+			return map[string]map[string]int{"bulk": {"send_email": 3}}, nil
+		},
+	}
+	m.warnStrandedTasks()
+	want := []string{"tasks wait in unsubscribed queue"}
+	if !reflect.DeepEqual(logger.events, want) {
+		t.Errorf("Manager.warnStrandedTasks() logged %v, want %v", logger.events, want)
+	}
+	wantFields := []interface{}{"queue", "bulk", "job", "send_email", "count", 3}
+	if len(logger.fields) != 1 || !reflect.DeepEqual(logger.fields[0], wantFields) {
+		t.Errorf("Manager.warnStrandedTasks() fields = %v, want %v", logger.fields, wantFields)
+	}
+}
+
+func TestManager_RegisterQueue(t *testing.T) {
+	m := NewManager("")
+	if err := m.RegisterQueue("critical", WithQueueWorkerPoolSize(2)); err != nil {
+		t.Fatalf("Manager.RegisterQueue() error = %v", err)
+	}
+	if err := m.RegisterQueue("critical"); err != ErrQueueRegistered {
+		t.Errorf("Manager.RegisterQueue() error = %v, want %v", err, ErrQueueRegistered)
+	}
+	if err := m.RegisterQueue("bulk", WithQueueWorkerPoolSize(0)); err != ErrInvalidPoolSize {
+		t.Errorf("Manager.RegisterQueue() error = %v, want %v", err, ErrInvalidPoolSize)
+	}
+}
+
+func TestManager_setupWorkerPools(t *testing.T) {
+	m := NewManager("")
+	job := &mockJob{}
+	for _, name := range []string{"send_email", "resize_image", "cleanup"} {
+		if err := m.Register(name, job); err != nil {
+			t.Fatalf("Manager.Register() error = %v", err)
+		}
+	}
+	if err := m.RegisterQueue("shared",
+		WithQueueSubscription("send_email", 3),
+		WithQueueSubscription("bulk", 1),
+	); err != nil {
+		t.Fatalf("Manager.RegisterQueue() error = %v", err)
+	}
+	if err := m.RegisterQueue("resize_image"); err != nil {
+		t.Fatalf("Manager.RegisterQueue() error = %v", err)
+	}
+	m.setupWorkerPools(context.Background())
+	// send_email queue is handled by shared pool and cleanup gets implicit pool
+	for _, name := range []string{"shared", "resize_image", "cleanup"} {
+		if _, ok := m.pools[name]; !ok {
+			t.Errorf("Manager.setupWorkerPools() pool %s not created", name)
+		}
+	}
+	if len(m.pools) != 3 {
+		t.Errorf("Manager.setupWorkerPools() created %d pools, want 3", len(m.pools))
+	}
+	for queue, want := range map[string]*workerPool{
+		"send_email":   m.pools["shared"],
+		"bulk":         m.pools["shared"],
+		"resize_image": m.pools["resize_image"],
+		"cleanup":      m.pools["cleanup"],
+	} {
+		subs := m.subscribers[queue]
+		if len(subs) != 1 || subs[0] != want {
+			t.Errorf("Manager.setupWorkerPools() subscribers of %s = %v", queue, subs)
+		}
+	}
+}
+
+func TestManager_RegisterBatch(t *testing.T) {
+	m := NewManager("")
+	job := BatchJobFunc(func(context.Context, []*Task) error {
+		return nil
+	})
+	if err := m.RegisterBatch("index_document", job, WithJobBatchSize(50)); err != nil {
+		t.Fatalf("Manager.RegisterBatch() error = %v", err)
+	}
+	if err := m.RegisterBatch("index_document", job); err != ErrAlreadyRegistered {
+		t.Errorf("Manager.RegisterBatch() error = %v, want %v", err, ErrAlreadyRegistered)
+	}
+	if err := m.RegisterBatch("other", nil); err != ErrInvalidJob {
+		t.Errorf("Manager.RegisterBatch() error = %v, want %v", err, ErrInvalidJob)
+	}
+	mw := func(job Job) Job { return job }
+	if err := m.RegisterBatch("other", job, WithJobMiddleware(mw)); err != ErrBatchJobMiddleware {
+		t.Errorf("Manager.RegisterBatch() error = %v, want %v", err, ErrBatchJobMiddleware)
+	}
+	factory := &workerFactory{}
+	m.addJob(factory, "index_document")
+	w := factory.Make().(*worker)
+	if w.jobs["index_document"].batch == nil {
+		t.Errorf("Manager.addJob() batch job was not added as batch job")
+	}
+	if claims := w.claims(); len(claims) != 1 || claims[0].limit != 50 {
+		t.Errorf("worker.claims() = %v, want a claim of %v tasks", claims, 50)
+	}
+}
+
+func TestManager_reapInterval(t *testing.T) {
+	m := NewManager("")
+	if got := m.reapInterval(); got != 0 {
+		t.Errorf("Manager.reapInterval() = %v, want 0", got)
+	}
+	if err := m.RegisterQueue("reports", WithQueueLease(time.Minute)); err != nil {
+		t.Fatalf("Manager.RegisterQueue() error = %v", err)
+	}
+	if err := m.RegisterQueue("exports", WithQueueLease(30*time.Second)); err != nil {
+		t.Fatalf("Manager.RegisterQueue() error = %v", err)
+	}
+	if err := m.RegisterQueue("emails"); err != nil {
+		t.Fatalf("Manager.RegisterQueue() error = %v", err)
+	}
+	if got := m.reapInterval(); got != 30*time.Second {
+		t.Errorf("Manager.reapInterval() = %v, want %v", got, 30*time.Second)
+	}
+}
+
+func TestManager_Schedule(t *testing.T) {
+	m := NewManager("")
+	body := func(time.Time) (Valuer, error) {
+		return mockBody{[]byte(`{}`)}, nil
+	}
+	if err := m.Schedule("nightly_report", "0 3 * * *", "send_report", body, WithScheduleTimezone("UTC")); err != nil {
+		t.Fatalf("Manager.Schedule() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		schedule string
+		spec     string
+		body     BodyFactory
+		opts     []ScheduleOption
+		want     error
+	}{
+		{name: "registered", schedule: "nightly_report", spec: "@daily", body: body, want: ErrScheduleRegistered},
+		{name: "invalid_name", schedule: "Nightly", spec: "@daily", body: body, want: ErrInvalidScheduleName},
+		{name: "invalid_spec", schedule: "other", spec: "* *", body: body, want: ErrInvalidCronSpec},
+		{name: "never_runs", schedule: "other", spec: "0 0 31 2 *", body: body, want: ErrInvalidCronSpec},
+		{name: "nil_body", schedule: "other", spec: "@daily", want: ErrInvalidBodyFactory},
+		{name: "invalid_timezone", schedule: "other", spec: "@daily", body: body, opts: []ScheduleOption{WithScheduleTimezone("Nowhere/Nothing")}, want: ErrInvalidTimezone},
+		{name: "invalid_catch_up", schedule: "other", spec: "@daily", body: body, opts: []ScheduleOption{WithScheduleCatchUp(CatchUpPolicy(9))}, want: ErrInvalidCatchUpPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Schedule(tt.schedule, tt.spec, "send_report", tt.body, tt.opts...); err != tt.want {
+				t.Errorf("Manager.Schedule() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_runSchedules(t *testing.T) {
+	m := NewManager("")
+	body := func(time.Time) (Valuer, error) {
+		return mockBody{[]byte(`{}`)}, nil
+	}
+	if err := m.Schedule("every_minute", "* * * * *", "send_report", body); err != nil {
+		t.Fatalf("Manager.Schedule() error = %v", err)
+	}
+	act := &mockScheduleAction{
+		rows: []*ScheduleRow{{
+			name:      "every_minute",
+			nextRunAt: nullTime{Valid: true, Time: time.Now().UTC()},
+		}},
+	}
+	var claimed []string
+	m.store = &mockStore{
+		onClaimSchedules: func(names []string, until time.Time) (ScheduleAction, error) {
+			claimed = names
+			return act, nil
+		},
+	}
+	m.runSchedules()
+	if len(claimed) != 1 || claimed[0] != "every_minute" {
+		t.Errorf("Manager.runSchedules() claimed = %v, want [every_minute]", claimed)
+	}
+	if len(act.queued) == 0 || len(act.advanced) != 1 {
+		t.Errorf("Manager.runSchedules() queued %d tasks, advanced %d schedules, want > 0 and 1", len(act.queued), len(act.advanced))
+	}
+	errBody := errors.New("body err")
+	failing := func(time.Time) (Valuer, error) {
+		return nil, errBody
+	}
+	if err := m.Schedule("failing", "* * * * *", "send_report", failing); err != nil {
+		t.Fatalf("Manager.Schedule() error = %v", err)
+	}
+	act = &mockScheduleAction{
+		rows: []*ScheduleRow{
+			{name: "failing", nextRunAt: nullTime{Valid: true, Time: time.Now().UTC()}},
+			{name: "every_minute", nextRunAt: nullTime{Valid: true, Time: time.Now().UTC()}},
+		},
+	}
+	m.store = &mockStore{
+		onClaimSchedules: func(names []string, until time.Time) (ScheduleAction, error) {
+			return act, nil
+		},
+	}
+	var errs []error
+	m.options.errorHandler = func(err error) {
+		errs = append(errs, err)
+	}
+	m.runSchedules()
+	if len(errs) != 1 || !errors.Is(errs[0], errBody) {
+		t.Errorf("Manager.runSchedules() errors = %v, want [%v]", errs, errBody)
+	}
+	if len(act.queued) == 0 || len(act.advanced) != 1 || act.advanced[0].name != "every_minute" {
+		t.Errorf("Manager.runSchedules() failing schedule stopped other schedules, advanced %v", act.advanced)
+	}
+	m.store = &mockStore{
+		onClaimSchedules: func(names []string, until time.Time) (ScheduleAction, error) {
+			return nil, ErrNoDueSchedules
+		},
+	}
+	m.options.errorHandler = func(err error) {
+		t.Errorf("Manager.runSchedules() error = %v", err)
+	}
+	m.runSchedules()
+}
+
+func TestManager_purgeHistory(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []ManagerOption
+		wantPurged   bool
+		wantCanceled bool
+	}{
+		{
+			name:         "disabled",
+			wantCanceled: true,
+		},
+		{
+			name: "kept_forever",
+			opts: []ManagerOption{WithManagerHistory(0)},
+		},
+		{
+			name:       "retention",
+			opts:       []ManagerOption{WithManagerHistory(time.Hour)},
+			wantPurged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager("", tt.opts...)
+			var purged, canceled bool
+			m.store = &mockStore{
+				onPurgeHistory: func(before time.Time) (int64, error) {
+					purged = true
+					return 0, nil
+				},
+				onPurgeCanceled: func(before time.Time) (int64, error) {
+					canceled = true
+					return 0, nil
+				},
+			}
+			m.purgeHistory()
+			if purged != tt.wantPurged || canceled != tt.wantCanceled {
+				t.Errorf("Manager.purgeHistory() purged = %v, canceled = %v, want %v, %v", purged, canceled, tt.wantPurged, tt.wantCanceled)
+			}
+		})
+	}
+}
+
+// mockStatsWorker finishes it's running tasks when stopped
+type mockStatsWorker struct {
+	stats   WorkerStats
+	running int
+	stuck   bool
+}
+
+func (w *mockStatsWorker) ID() int            { return 0 }
+func (w *mockStatsWorker) IsWorking() bool    { return w.running > 0 }
+func (w *mockStatsWorker) Start()             {}
+func (w *mockStatsWorker) Resume()            {}
+func (w *mockStatsWorker) Pause()             {}
+func (w *mockStatsWorker) Stats() WorkerStats { return w.stats }
+func (w *mockStatsWorker) Stop() {
+	if w.stuck {
+		w.stats.Abandoned += w.running
+	} else {
+		w.stats.Handled += w.running
+	}
+	w.running = 0
+}
+
+func TestManager_drain(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers []Worker
+		want    ShutdownStats
+		wantErr bool
+	}{
+		{
+			name: "drained",
+			workers: []Worker{
+				&mockStatsWorker{running: 2, stats: WorkerStats{Handled: 5}},
+				&mockStatsWorker{},
+			},
+			want: ShutdownStats{Drained: 2},
+		},
+		{
+			name: "abandoned",
+			workers: []Worker{
+				&mockStatsWorker{running: 1},
+				&mockStatsWorker{running: 1, stuck: true},
+			},
+			want:    ShutdownStats{Drained: 1, Abandoned: 1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager("")
+			m.cancel = func() {}
+			m.pools["test"] = &workerPool{workers: tt.workers}
+			got := m.drain(context.Background())
+			if got != tt.want {
+				t.Errorf("Manager.drain() = %v, want %v", got, tt.want)
+			}
+			err := got.err()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ShutdownStats.err() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var serr *ShutdownError
+			if tt.wantErr && (!errors.As(err, &serr) || serr.ShutdownStats != tt.want) {
+				t.Errorf("ShutdownStats.err() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package jobq
+
+import (
+	"time"
+)
+
+// Metrics records task and worker metrics.
+// metrics.Collector implements it in Prometheus format
+type Metrics interface {
+	// TaskEnqueued is called when n tasks of a job are inserted by
+	// PreparedTask.Queue or QueueBatch of tasks made with WithTaskMetrics.
+	// Tasks skipped as duplicates and requeued tasks are not counted
+	TaskEnqueued(job string, n int)
+	// TaskDequeued is called when worker takes a task.
+	// queued is time since task was created
+	TaskDequeued(job string, queued time.Duration)
+	TaskSucceeded(job string, d time.Duration)
+	TaskFailed(job string, d time.Duration)
+	TaskRequeued(job string)
+	TaskBuried(job string)
+	// WorkerBusy is called when worker of a queue starts
+	// and finishes handling a task
+	WorkerBusy(queue string, busy bool)
+	// QueueDepth is called periodically with number of pending
+	// and running tasks of a registered job in a subscribed queue
+	QueueDepth(queue, job string, n int)
+}
+
+// nopMetrics discards all metrics
+type nopMetrics struct{}
+
+func (nopMetrics) TaskEnqueued(job string, n int)                {}
+func (nopMetrics) TaskDequeued(job string, queued time.Duration) {}
+func (nopMetrics) TaskSucceeded(job string, d time.Duration)     {}
+func (nopMetrics) TaskFailed(job string, d time.Duration)        {}
+func (nopMetrics) TaskRequeued(job string)                       {}
+func (nopMetrics) TaskBuried(job string)                         {}
+func (nopMetrics) WorkerBusy(queue string, busy bool)            {}
+func (nopMetrics) QueueDepth(queue, job string, n int)           {}
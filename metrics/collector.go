@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Collector records task and worker metrics of jobq.Manager.
+// It implements jobq.Metrics
+type Collector struct {
+	enqueued    *Counter
+	dequeued    *Counter
+	succeeded   *Counter
+	failed      *Counter
+	requeued    *Counter
+	buried      *Counter
+	duration    *Histogram
+	queueTime   *Histogram
+	busyWorkers *Gauge
+	queueDepth  *Gauge
+}
+
+// NewCollector registers jobq metrics in registry
+func NewCollector(r *Registry) *Collector {
+	return &Collector{
+		enqueued:    r.NewCounter("jobq_tasks_enqueued_total", "Number of tasks queued by producers.", "job"),
+		dequeued:    r.NewCounter("jobq_tasks_dequeued_total", "Number of tasks taken by workers.", "job"),
+		succeeded:   r.NewCounter("jobq_tasks_succeeded_total", "Number of tasks handled successfully.", "job"),
+		failed:      r.NewCounter("jobq_tasks_failed_total", "Number of failed task attempts.", "job"),
+		requeued:    r.NewCounter("jobq_tasks_requeued_total", "Number of failed tasks returned to task queue.", "job"),
+		buried:      r.NewCounter("jobq_tasks_buried_total", "Number of tasks moved to dead tasks.", "job"),
+		duration:    r.NewHistogram("jobq_task_handle_duration_seconds", "Time spent handling a task.", nil, "job"),
+		queueTime:   r.NewHistogram("jobq_task_queue_duration_seconds", "Time since task was created until it was taken by a worker.", nil, "job"),
+		busyWorkers: r.NewGauge("jobq_busy_workers", "Number of workers handling a task.", "queue"),
+		queueDepth:  r.NewGauge("jobq_queue_depth", "Number of pending and running tasks.", "queue", "job"),
+	}
+}
+
+// TaskEnqueued counts n tasks queued by a producer
+func (c *Collector) TaskEnqueued(job string, n int) {
+	c.enqueued.Add(float64(n), job)
+}
+
+// TaskDequeued counts a task taken by a worker and
+// observes how long it has been in task queue
+func (c *Collector) TaskDequeued(job string, queued time.Duration) {
+	c.dequeued.Inc(job)
+	c.queueTime.Observe(queued.Seconds(), job)
+}
+
+// TaskSucceeded counts a successful task and observes it's duration
+func (c *Collector) TaskSucceeded(job string, d time.Duration) {
+	c.succeeded.Inc(job)
+	c.duration.Observe(d.Seconds(), job)
+}
+
+// TaskFailed counts a failed task and observes it's duration
+func (c *Collector) TaskFailed(job string, d time.Duration) {
+	c.failed.Inc(job)
+	c.duration.Observe(d.Seconds(), job)
+}
+
+// TaskRequeued counts a task returned to task queue
+func (c *Collector) TaskRequeued(job string) {
+	c.requeued.Inc(job)
+}
+
+// TaskBuried counts a task moved to dead tasks
+func (c *Collector) TaskBuried(job string) {
+	c.buried.Inc(job)
+}
+
+// WorkerBusy changes number of busy workers of a queue
+func (c *Collector) WorkerBusy(queue string, busy bool) {
+	if busy {
+		c.busyWorkers.Add(1, queue)
+	} else {
+		c.busyWorkers.Add(-1, queue)
+	}
+}
+
+// QueueDepth sets number of tasks of a job in a queue
+func (c *Collector) QueueDepth(queue, job string, n int) {
+	c.queueDepth.Set(float64(n), queue, job)
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	r := NewRegistry()
+	c := NewCollector(r)
+	c.TaskEnqueued("test", 3)
+	c.TaskDequeued("test", time.Second)
+	c.WorkerBusy("default", true)
+	c.QueueDepth("default", "test", 4)
+	c.TaskFailed("test", time.Millisecond)
+	c.TaskRequeued("test")
+	c.TaskDequeued("test", time.Second)
+	c.TaskSucceeded("test", time.Millisecond)
+	c.TaskBuried("other")
+	b := new(strings.Builder)
+	if _, err := r.WriteTo(b); err != nil {
+		t.Fatalf("Registry.WriteTo() error = %v", err)
+	}
+	for _, want := range []string{
+		`jobq_tasks_enqueued_total{job="test"} 3`,
+		`jobq_tasks_dequeued_total{job="test"} 2`,
+		`jobq_tasks_succeeded_total{job="test"} 1`,
+		`jobq_tasks_failed_total{job="test"} 1`,
+		`jobq_tasks_requeued_total{job="test"} 1`,
+		`jobq_tasks_buried_total{job="other"} 1`,
+		`jobq_busy_workers{queue="default"} 1`,
+		`jobq_queue_depth{queue="default",job="test"} 4`,
+		`jobq_task_handle_duration_seconds_count{job="test"} 2`,
+		`jobq_task_queue_duration_seconds_sum{job="test"} 2`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("Collector metrics do not contain %q", want)
+		}
+	}
+}
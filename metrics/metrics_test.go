@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "Test counter.", "job")
+	g := r.NewGauge("test_gauge", "Test\ngauge.")
+	h := r.NewHistogram("test_seconds", "Test histogram.", []float64{1, 0.5}, "job")
+	c.Inc(`a"b`)
+	c.Add(2, "c")
+	c.Add(-1, "c")
+	g.Set(3)
+	g.Add(-1)
+	h.Observe(0.2, "a")
+	h.Observe(0.7, "a")
+	h.Observe(2, "a")
+	want := `# HELP test_gauge Test\ngauge.
+# TYPE test_gauge gauge
+test_gauge 2
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{job="a",le="0.5"} 1
+test_seconds_bucket{job="a",le="1"} 2
+test_seconds_bucket{job="a",le="+Inf"} 3
+test_seconds_sum{job="a"} 2.9
+test_seconds_count{job="a"} 3
+# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{job="a\"b"} 1
+test_total{job="c"} 2
+`
+	b := new(strings.Builder)
+	n, err := r.WriteTo(b)
+	if err != nil {
+		t.Fatalf("Registry.WriteTo() error = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("Registry.WriteTo() = \n%s\nwant\n%s", got, want)
+	}
+	if n != int64(len(want)) {
+		t.Errorf("Registry.WriteTo() n = %v, want %v", n, len(want))
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Test counter.").Inc()
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Registry.Handler() Content-Type = %v", got)
+	}
+	if got := rec.Body.String(); !strings.Contains(got, "test_total 1\n") {
+		t.Errorf("Registry.Handler() body = %v", got)
+	}
+}
+
+func TestRegistry_register(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(r *Registry)
+	}{
+		{
+			name: "duplicate_name",
+			fn: func(r *Registry) {
+				r.NewCounter("test_total", "")
+				r.NewGauge("test_total", "")
+			},
+		},
+		{
+			name: "wrong_label_values",
+			fn: func(r *Registry) {
+				r.NewCounter("test_total", "", "job").Inc()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic")
+				}
+			}()
+			tt.fn(NewRegistry())
+		})
+	}
+}
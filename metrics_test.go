@@ -0,0 +1,35 @@
+package jobq
+
+import (
+	"sync"
+	"time"
+)
+
+type mockMetrics struct {
+	calls []string
+	busy  int
+	sync.Mutex
+}
+
+func (m *mockMetrics) call(name string) {
+	m.Lock()
+	defer m.Unlock()
+	m.calls = append(m.calls, name)
+}
+
+func (m *mockMetrics) TaskEnqueued(job string, n int)                { m.call("enqueued") }
+func (m *mockMetrics) TaskDequeued(job string, queued time.Duration) { m.call("dequeued") }
+func (m *mockMetrics) TaskSucceeded(job string, d time.Duration)     { m.call("succeeded") }
+func (m *mockMetrics) TaskFailed(job string, d time.Duration)        { m.call("failed") }
+func (m *mockMetrics) TaskRequeued(job string)                       { m.call("requeued") }
+func (m *mockMetrics) TaskBuried(job string)                         { m.call("buried") }
+func (m *mockMetrics) QueueDepth(queue, job string, n int)           { m.call("depth") }
+func (m *mockMetrics) WorkerBusy(queue string, busy bool) {
+	m.Lock()
+	defer m.Unlock()
+	if busy {
+		m.busy++
+	} else {
+		m.busy--
+	}
+}
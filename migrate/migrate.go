@@ -115,7 +115,14 @@ func setActive(tx *sql.Tx, id int) error {
 	return err
 }
 
+// Migrate applies registered migrations
 func Migrate(db *sql.DB) error {
+	return MigrateWithCallback(db, nil)
+}
+
+// MigrateWithCallback applies registered migrations and calls
+// callback with id of each applied migration after they are committed
+func MigrateWithCallback(db *sql.DB, callback func(id int)) error {
 	if migrations.Len() == 0 {
 		return nil
 	}
@@ -150,19 +157,29 @@ func Migrate(db *sql.DB) error {
 			}
 		}
 	}
+	var applied []int
 	if startAt < max {
 		for at := startAt + 1; at <= max; at++ {
 			err = up(tx, at)
 			if err != nil {
 				return err
 			}
+			applied = append(applied, migrations[at].ID)
 		}
 	}
 	err = setActive(tx, migrations.Last().ID)
 	if err != nil {
 		return err
 	}
-	return tx.Commit()
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	if callback != nil {
+		for _, id := range applied {
+			callback(id)
+		}
+	}
+	return nil
 }
 
 func up(tx *sql.Tx, at int) error {
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 0006,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN attempts int NOT NULL DEFAULT 0;
+			`
+		},
+		Down: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS attempts;
+			`
+		},
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 0007,
+		Up: func() string {
+			return `
+				CREATE TABLE IF NOT EXISTS jobq_dead_tasks (
+					id BIGSERIAL,
+					uid uuid NOT NULL,
+					job_name varchar(100) NOT NULL,
+					body jsonb NOT NULL,
+					retries int NOT NULL,
+					attempts int NOT NULL,
+					last_error text NOT NULL DEFAULT '',
+					failed_at timestamp NOT NULL DEFAULT NOW(),
+					PRIMARY KEY(id),
+					CONSTRAINT jobq_dead_task_uid_unique UNIQUE (uid)
+				);
+			`
+		},
+		Down: func() string {
+			return `
+				DROP TABLE IF EXISTS jobq_dead_tasks;
+			`
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 8,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN retry_policy jsonb;
+				ALTER TABLE jobq_dead_tasks
+				ADD COLUMN retry_policy jsonb;
+			`
+		},
+		Down: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS retry_policy;
+				ALTER TABLE jobq_dead_tasks
+				DROP COLUMN IF EXISTS retry_policy;
+			`
+		},
+	})
+}
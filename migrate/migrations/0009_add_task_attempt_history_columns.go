@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 9,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN last_error text NOT NULL DEFAULT '',
+				ADD COLUMN created_at timestamp NOT NULL DEFAULT NOW(),
+				ADD COLUMN last_attempted_at timestamp;
+				ALTER TABLE jobq_dead_tasks
+				ADD COLUMN created_at timestamp NOT NULL DEFAULT NOW(),
+				ADD COLUMN last_attempted_at timestamp;
+			`
+		},
+		Down: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS last_error,
+				DROP COLUMN IF EXISTS created_at,
+				DROP COLUMN IF EXISTS last_attempted_at;
+				ALTER TABLE jobq_dead_tasks
+				DROP COLUMN IF EXISTS created_at,
+				DROP COLUMN IF EXISTS last_attempted_at;
+			`
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 10,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN ttl bigint;
+				ALTER TABLE jobq_dead_tasks
+				ADD COLUMN ttl bigint;
+			`
+		},
+		Down: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS ttl;
+				ALTER TABLE jobq_dead_tasks
+				DROP COLUMN IF EXISTS ttl;
+			`
+		},
+	})
+}
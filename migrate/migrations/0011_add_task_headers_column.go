@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 11,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN headers jsonb;
+				ALTER TABLE jobq_dead_tasks
+				ADD COLUMN headers jsonb;
+			`
+		},
+		Down: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS headers;
+				ALTER TABLE jobq_dead_tasks
+				DROP COLUMN IF EXISTS headers;
+			`
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 12,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN priority integer NOT NULL DEFAULT 0;
+				ALTER TABLE jobq_dead_tasks
+				ADD COLUMN priority integer NOT NULL DEFAULT 0;
+				CREATE INDEX IF NOT EXISTS jobq_task_priority_idx
+				ON jobq_tasks (job_name, priority DESC, id ASC);
+			`
+		},
+		Down: func() string {
+			return `
+				DROP INDEX IF EXISTS jobq_task_priority_idx;
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS priority;
+				ALTER TABLE jobq_dead_tasks
+				DROP COLUMN IF EXISTS priority;
+			`
+		},
+	})
+}
@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 13,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN queue varchar(100);
+				UPDATE jobq_tasks SET queue = job_name;
+				ALTER TABLE jobq_tasks
+				ALTER COLUMN queue SET NOT NULL;
+				ALTER TABLE jobq_dead_tasks
+				ADD COLUMN queue varchar(100);
+				UPDATE jobq_dead_tasks SET queue = job_name;
+				ALTER TABLE jobq_dead_tasks
+				ALTER COLUMN queue SET NOT NULL;
+				CREATE INDEX IF NOT EXISTS jobq_task_queue_priority_idx
+				ON jobq_tasks (queue, priority DESC, id ASC);
+				CREATE OR REPLACE FUNCTION jobq_notify_task_created() RETURNS TRIGGER AS $$
+				DECLARE
+					notification jsonb;
+				BEGIN
+					notification = json_build_object(
+						'job_name', NEW.job_name,
+						'queue', NEW.queue,
+						'timeout', NEW.timeout,
+						'start_at', NEW.start_at
+					);
+					PERFORM pg_notify('jobq_task_created', notification::text);
+					RETURN NULL;
+				END;
+				$$ LANGUAGE plpgsql;
+			`
+		},
+		Down: func() string {
+			return `
+				CREATE OR REPLACE FUNCTION jobq_notify_task_created() RETURNS TRIGGER AS $$
+				DECLARE
+					notification jsonb;
+				BEGIN
+					notification = json_build_object(
+						'job_name', NEW.job_name,
+						'timeout', NEW.timeout,
+						'start_at', NEW.start_at
+					);
+					PERFORM pg_notify('jobq_task_created', notification::text);
+					RETURN NULL;
+				END;
+				$$ LANGUAGE plpgsql;
+				DROP INDEX IF EXISTS jobq_task_queue_priority_idx;
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS queue;
+				ALTER TABLE jobq_dead_tasks
+				DROP COLUMN IF EXISTS queue;
+			`
+		},
+	})
+}
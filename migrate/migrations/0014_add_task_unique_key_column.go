@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 14,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN unique_key text;
+				CREATE UNIQUE INDEX IF NOT EXISTS jobq_task_unique_key_idx
+				ON jobq_tasks (unique_key) WHERE unique_key IS NOT NULL;
+				ALTER TABLE jobq_dead_tasks
+				ADD COLUMN unique_key text;
+			`
+		},
+		Down: func() string {
+			return `
+				ALTER TABLE jobq_dead_tasks
+				DROP COLUMN IF EXISTS unique_key;
+				DROP INDEX IF EXISTS jobq_task_unique_key_idx;
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS unique_key;
+			`
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 15,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ALTER COLUMN uid TYPE varchar(255);
+				ALTER TABLE jobq_dead_tasks
+				ALTER COLUMN uid TYPE varchar(255);
+			`
+		},
+		Down: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ALTER COLUMN uid TYPE uuid USING uid::uuid;
+				ALTER TABLE jobq_dead_tasks
+				ALTER COLUMN uid TYPE uuid USING uid::uuid;
+			`
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 16,
+		Up: func() string {
+			return `
+				DROP TRIGGER IF EXISTS jobq_task_trigger ON jobq_tasks;
+				CREATE OR REPLACE FUNCTION jobq_notify_tasks_created() RETURNS TRIGGER AS $$
+				DECLARE
+					created record;
+				BEGIN
+					FOR created IN
+						SELECT job_name, queue, COUNT(*) AS count,
+							MIN(timeout) AS timeout, MIN(start_at) AS start_at
+						FROM new_tasks
+						GROUP BY job_name, queue
+					LOOP
+						PERFORM pg_notify('jobq_task_created', json_build_object(
+							'job_name', created.job_name,
+							'queue', created.queue,
+							'count', created.count,
+							'timeout', created.timeout,
+							'start_at', created.start_at
+						)::text);
+					END LOOP;
+					RETURN NULL;
+				END;
+				$$ LANGUAGE plpgsql;
+				CREATE TRIGGER jobq_tasks_created_trigger
+					AFTER INSERT ON jobq_tasks
+					REFERENCING NEW TABLE AS new_tasks
+					FOR EACH STATEMENT EXECUTE PROCEDURE jobq_notify_tasks_created();
+			`
+		},
+		Down: func() string {
+			return `
+				DROP TRIGGER IF EXISTS jobq_tasks_created_trigger ON jobq_tasks;
+				DROP FUNCTION IF EXISTS jobq_notify_tasks_created();
+				CREATE TRIGGER jobq_task_trigger
+					AFTER INSERT ON jobq_tasks
+					FOR EACH ROW EXECUTE PROCEDURE jobq_notify_task_created();
+			`
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 17,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ADD COLUMN locked_by varchar(255),
+				ADD COLUMN locked_until timestamp;
+				CREATE INDEX IF NOT EXISTS jobq_task_locked_until_idx
+				ON jobq_tasks (locked_until) WHERE locked_until IS NOT NULL;
+			`
+		},
+		Down: func() string {
+			return `
+				DROP INDEX IF EXISTS jobq_task_locked_until_idx;
+				ALTER TABLE jobq_tasks
+				DROP COLUMN IF EXISTS locked_by,
+				DROP COLUMN IF EXISTS locked_until;
+			`
+		},
+	})
+}
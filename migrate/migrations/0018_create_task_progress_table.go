@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 18,
+		Up: func() string {
+			return `
+				CREATE TABLE IF NOT EXISTS jobq_task_progress (
+					uid varchar(255) PRIMARY KEY,
+					percent double precision NOT NULL,
+					message text NOT NULL DEFAULT '',
+					updated_at timestamp NOT NULL DEFAULT NOW()
+				);
+				CREATE OR REPLACE FUNCTION jobq_clear_task_uid() RETURNS TRIGGER AS $$
+				BEGIN
+					DELETE FROM jobq_task_progress
+					WHERE uid = NEW.uid AND updated_at < NEW.created_at;
+					RETURN NULL;
+				END;
+				$$ LANGUAGE plpgsql;
+				CREATE TRIGGER jobq_task_uid_trigger
+					AFTER INSERT ON jobq_tasks
+					FOR EACH ROW EXECUTE PROCEDURE jobq_clear_task_uid();
+			`
+		},
+		Down: func() string {
+			return `
+				DROP TRIGGER IF EXISTS jobq_task_uid_trigger ON jobq_tasks;
+				DROP FUNCTION IF EXISTS jobq_clear_task_uid();
+				DROP TABLE IF EXISTS jobq_task_progress;
+			`
+		},
+	})
+}
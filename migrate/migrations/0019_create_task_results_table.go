@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 19,
+		Up: func() string {
+			return `
+				CREATE TABLE IF NOT EXISTS jobq_task_results (
+					uid varchar(255) PRIMARY KEY,
+					job_name varchar(100) NOT NULL,
+					body jsonb,
+					created_at timestamp NOT NULL DEFAULT NOW(),
+					expires_at timestamp NOT NULL
+				);
+				CREATE INDEX IF NOT EXISTS jobq_task_result_expires_at_idx
+				ON jobq_task_results (expires_at);
+				CREATE OR REPLACE FUNCTION jobq_notify_task_finished() RETURNS TRIGGER AS $$
+				BEGIN
+					PERFORM pg_notify('jobq_task_finished', NEW.uid::text);
+					RETURN NULL;
+				END;
+				$$ LANGUAGE plpgsql;
+				CREATE TRIGGER jobq_task_result_trigger
+					AFTER INSERT OR UPDATE ON jobq_task_results
+					FOR EACH ROW EXECUTE PROCEDURE jobq_notify_task_finished();
+				CREATE TRIGGER jobq_dead_task_trigger
+					AFTER INSERT OR UPDATE ON jobq_dead_tasks
+					FOR EACH ROW EXECUTE PROCEDURE jobq_notify_task_finished();
+				CREATE OR REPLACE FUNCTION jobq_clear_task_uid() RETURNS TRIGGER AS $$
+				BEGIN
+					DELETE FROM jobq_task_progress
+					WHERE uid = NEW.uid AND updated_at < NEW.created_at;
+					DELETE FROM jobq_task_results
+					WHERE uid = NEW.uid AND created_at < NEW.created_at;
+					RETURN NULL;
+				END;
+				$$ LANGUAGE plpgsql;
+			`
+		},
+		Down: func() string {
+			return `
+				CREATE OR REPLACE FUNCTION jobq_clear_task_uid() RETURNS TRIGGER AS $$
+				BEGIN
+					DELETE FROM jobq_task_progress
+					WHERE uid = NEW.uid AND updated_at < NEW.created_at;
+					RETURN NULL;
+				END;
+				$$ LANGUAGE plpgsql;
+				DROP TRIGGER IF EXISTS jobq_dead_task_trigger ON jobq_dead_tasks;
+				DROP TRIGGER IF EXISTS jobq_task_result_trigger ON jobq_task_results;
+				DROP FUNCTION IF EXISTS jobq_notify_task_finished();
+				DROP TABLE IF EXISTS jobq_task_results;
+			`
+		},
+	})
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 20,
+		Up: func() string {
+			return `
+				CREATE TABLE IF NOT EXISTS jobq_task_history (
+					id BIGSERIAL,
+					uid varchar(255) NOT NULL,
+					job_name varchar(100) NOT NULL,
+					queue varchar(100) NOT NULL,
+					status varchar(20) NOT NULL,
+					attempts int NOT NULL,
+					worker varchar(255) NOT NULL,
+					duration bigint NOT NULL,
+					created_at timestamp,
+					finished_at timestamp NOT NULL DEFAULT NOW(),
+					PRIMARY KEY(id)
+				);
+				CREATE INDEX IF NOT EXISTS jobq_task_history_uid_idx
+				ON jobq_task_history (uid);
+				CREATE INDEX IF NOT EXISTS jobq_task_history_finished_at_idx
+				ON jobq_task_history (finished_at);
+			`
+		},
+		Down: func() string {
+			return `
+				DROP TABLE IF EXISTS jobq_task_history;
+			`
+		},
+	})
+}
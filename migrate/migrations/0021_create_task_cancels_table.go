@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 21,
+		Up: func() string {
+			return `
+				CREATE TABLE IF NOT EXISTS jobq_task_cancels (
+					task_id bigint NOT NULL,
+					uid varchar(255) NOT NULL,
+					created_at timestamp NOT NULL DEFAULT NOW(),
+					PRIMARY KEY(task_id)
+				);
+				CREATE INDEX IF NOT EXISTS jobq_task_cancels_uid_idx
+				ON jobq_task_cancels (uid);
+			`
+		},
+		Down: func() string {
+			return `
+				DROP TABLE IF EXISTS jobq_task_cancels;
+			`
+		},
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 22,
+		Up: func() string {
+			return `
+				CREATE TABLE IF NOT EXISTS jobq_schedules (
+					name varchar(100) NOT NULL,
+					job_name varchar(100) NOT NULL,
+					spec varchar(255) NOT NULL,
+					timezone varchar(100) NOT NULL,
+					next_run_at timestamp,
+					last_run_at timestamp,
+					created_at timestamp NOT NULL DEFAULT NOW(),
+					updated_at timestamp NOT NULL DEFAULT NOW(),
+					PRIMARY KEY(name)
+				);
+			`
+		},
+		Down: func() string {
+			return `
+				DROP TABLE IF EXISTS jobq_schedules;
+			`
+		},
+	})
+}
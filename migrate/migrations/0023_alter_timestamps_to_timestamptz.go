@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"github.com/dbarzdys/jobq/migrate"
+)
+
+// Columns set with NOW() hold wall clock time of the session time zone
+// and are converted in it. last_attempted_at is set by workers in UTC
+func init() {
+	migrate.RegisterMigration(migrate.Migration{
+		ID: 23,
+		Up: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ALTER COLUMN created_at TYPE timestamptz USING created_at::timestamptz,
+				ALTER COLUMN last_attempted_at TYPE timestamptz USING last_attempted_at AT TIME ZONE 'UTC';
+				ALTER TABLE jobq_dead_tasks
+				ALTER COLUMN created_at TYPE timestamptz USING created_at::timestamptz,
+				ALTER COLUMN last_attempted_at TYPE timestamptz USING last_attempted_at AT TIME ZONE 'UTC',
+				ALTER COLUMN failed_at TYPE timestamptz USING failed_at::timestamptz;
+				ALTER TABLE jobq_task_progress
+				ALTER COLUMN updated_at TYPE timestamptz USING updated_at::timestamptz;
+				ALTER TABLE jobq_task_results
+				ALTER COLUMN created_at TYPE timestamptz USING created_at::timestamptz,
+				ALTER COLUMN expires_at TYPE timestamptz USING expires_at::timestamptz;
+				ALTER TABLE jobq_task_history
+				ALTER COLUMN created_at TYPE timestamptz USING created_at::timestamptz,
+				ALTER COLUMN finished_at TYPE timestamptz USING finished_at::timestamptz;
+				ALTER TABLE jobq_task_cancels
+				ALTER COLUMN created_at TYPE timestamptz USING created_at::timestamptz;
+				ALTER TABLE jobq_schedules
+				ALTER COLUMN created_at TYPE timestamptz USING created_at::timestamptz,
+				ALTER COLUMN updated_at TYPE timestamptz USING updated_at::timestamptz;
+			`
+		},
+		Down: func() string {
+			return `
+				ALTER TABLE jobq_tasks
+				ALTER COLUMN created_at TYPE timestamp USING created_at::timestamp,
+				ALTER COLUMN last_attempted_at TYPE timestamp USING last_attempted_at AT TIME ZONE 'UTC';
+				ALTER TABLE jobq_dead_tasks
+				ALTER COLUMN created_at TYPE timestamp USING created_at::timestamp,
+				ALTER COLUMN last_attempted_at TYPE timestamp USING last_attempted_at AT TIME ZONE 'UTC',
+				ALTER COLUMN failed_at TYPE timestamp USING failed_at::timestamp;
+				ALTER TABLE jobq_task_progress
+				ALTER COLUMN updated_at TYPE timestamp USING updated_at::timestamp;
+				ALTER TABLE jobq_task_results
+				ALTER COLUMN created_at TYPE timestamp USING created_at::timestamp,
+				ALTER COLUMN expires_at TYPE timestamp USING expires_at::timestamp;
+				ALTER TABLE jobq_task_history
+				ALTER COLUMN created_at TYPE timestamp USING created_at::timestamp,
+				ALTER COLUMN finished_at TYPE timestamp USING finished_at::timestamp;
+				ALTER TABLE jobq_task_cancels
+				ALTER COLUMN created_at TYPE timestamp USING created_at::timestamp;
+				ALTER TABLE jobq_schedules
+				ALTER COLUMN created_at TYPE timestamp USING created_at::timestamp,
+				ALTER COLUMN updated_at TYPE timestamp USING updated_at::timestamp;
+			`
+		},
+	})
+}
@@ -1,9 +1,152 @@
 package jobq
 
 import (
+	"context"
+	"log"
 	"time"
 )
 
+// ErrorHandler handles errors that occur in background,
+// e.g. listener, store and worker errors
+type ErrorHandler func(error)
+
+// ManagerOptions contains all manager options
+type ManagerOptions struct {
+	errorHandler ErrorHandler
+	logger       Logger
+	metrics      Metrics
+	propagator   Propagator
+	tracer       Tracer
+	// priorityAging raises priority of waiting tasks
+	priorityAging time.Duration
+	// history keeps finished tasks for historyRetention
+	history          bool
+	historyRetention time.Duration
+	// drainTimeout is how long Run waits for running tasks
+	drainTimeout time.Duration
+}
+
+func (opts ManagerOptions) with(args ...ManagerOption) (ManagerOptions, error) {
+	for _, opt := range args {
+		if err := opt(&opts); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+var defaultManagerOptions = ManagerOptions{
+	errorHandler: func(err error) {
+		log.Printf("jobq: %v", err)
+	},
+	logger:  nopLogger{},
+	metrics: nopMetrics{},
+}
+
+// ManagerOption configures manager
+type ManagerOption func(*ManagerOptions) error
+
+// WithManagerErrorHandler sets handler for background errors.
+// Nil handler ignores errors (default: errors are logged)
+func WithManagerErrorHandler(handler ErrorHandler) ManagerOption {
+	return func(opts *ManagerOptions) error {
+		opts.errorHandler = handler
+		return nil
+	}
+}
+
+// WithManagerLogger sets logger for task, listener
+// and migration events (default: events are discarded)
+func WithManagerLogger(logger Logger) ManagerOption {
+	return func(opts *ManagerOptions) error {
+		if err := validateLogger(logger); err != nil {
+			return err
+		}
+		opts.logger = logger
+		return nil
+	}
+}
+
+// WithManagerMetrics sets metrics recorder, e.g.
+// metrics.Collector (default: metrics are discarded)
+func WithManagerMetrics(metrics Metrics) ManagerOption {
+	return func(opts *ManagerOptions) error {
+		if err := validateMetrics(metrics); err != nil {
+			return err
+		}
+		opts.metrics = metrics
+		return nil
+	}
+}
+
+// WithManagerPropagator sets propagator that restores trace context
+// of a task into context passed to Job.HandleTask (default: disabled)
+func WithManagerPropagator(propagator Propagator) ManagerOption {
+	return func(opts *ManagerOptions) error {
+		if err := validatePropagator(propagator); err != nil {
+			return err
+		}
+		opts.propagator = propagator
+		return nil
+	}
+}
+
+// WithManagerTracer sets tracer that starts a span
+// for each handled task (default: disabled)
+func WithManagerTracer(tracer Tracer) ManagerOption {
+	return func(opts *ManagerOptions) error {
+		if err := validateTracer(tracer); err != nil {
+			return err
+		}
+		opts.tracer = tracer
+		return nil
+	}
+}
+
+// WithManagerPriorityAging raises priority of a waiting task by 1
+// every interval, so that low priority tasks would not starve.
+// Aged priority is not stored, so priority index is not used and
+// every dequeue sorts all ready tasks of the queue. Prefer it for
+// queues with short backlogs. Zero interval disables aging (default: disabled)
+func WithManagerPriorityAging(interval time.Duration) ManagerOption {
+	return func(opts *ManagerOptions) error {
+		if err := validatePriorityAging(interval); err != nil {
+			return err
+		}
+		opts.priorityAging = interval
+		return nil
+	}
+}
+
+// WithManagerDrainTimeout sets how long Manager.Run waits for running
+// tasks to finish after it's context is done before they are canceled
+// and returned to task queue (default: 0, tasks are canceled at once)
+func WithManagerDrainTimeout(timeout time.Duration) ManagerOption {
+	return func(opts *ManagerOptions) error {
+		if err := validateDrainTimeout(timeout); err != nil {
+			return err
+		}
+		opts.drainTimeout = timeout
+		return nil
+	}
+}
+
+// WithManagerHistory keeps finished tasks in task history, so that
+// it could be checked whether a task ran with Client.History. Entries
+// older than retention, including canceled tasks, are pruned and zero
+// retention keeps them forever. Canceled tasks are kept in history for
+// 24 hours while it's disabled (default: disabled)
+func WithManagerHistory(retention time.Duration) ManagerOption {
+	return func(opts *ManagerOptions) error {
+		if err := validateHistoryRetention(retention); err != nil {
+			return err
+		}
+		opts.history = true
+		opts.historyRetention = retention
+		return nil
+	}
+}
+
 // JobOptions contains all job options
 type JobOptions struct {
 	timeoutEnabled bool
@@ -11,7 +154,13 @@ type JobOptions struct {
 	retries        int
 	requeuing      bool
 	workerPoolSize int
+	ttlEnabled     bool
 	ttl            time.Duration
+	middlewares    []JobMiddleware
+	maxAttempts    int
+	retryPolicy    RetryPolicy
+	batchSize      int
+	resultTTL      time.Duration
 }
 
 func (opts JobOptions) with(args ...JobOption) (JobOptions, error) {
@@ -29,7 +178,10 @@ var defaultJobOptions = JobOptions{
 	retries:        5,
 	requeuing:      true,
 	workerPoolSize: 1,
+	ttlEnabled:     true,
 	ttl:            time.Second * 20,
+	batchSize:      1,
+	resultTTL:      time.Hour * 24,
 }
 
 // JobOption configures job
@@ -77,8 +229,12 @@ func WithJobRequeuing(enabled bool) JobOption {
 	}
 }
 
-// WithJobWorkerPoolSize sets how many workers should
-// handle this job(default: 1)
+// WithJobWorkerPoolSize sets how many workers should handle
+// tasks queued to the queue of this job (default: 1).
+// It is ignored if the queue is registered with Manager.RegisterQueue.
+//
+// Deprecated: use Manager.RegisterQueue with WithQueueWorkerPoolSize
+// to share workers between jobs
 func WithJobWorkerPoolSize(size int) JobOption {
 	return func(opts *JobOptions) error {
 		if err := validatePoolSize(size); err != nil {
@@ -89,11 +245,271 @@ func WithJobWorkerPoolSize(size int) JobOption {
 	}
 }
 
+// WithJobTTL sets how long task can be handled
+// before it's context is canceled (default: 20s).
+// Tasks handled for longer fail even if handler returns nil
+func WithJobTTL(ttl time.Duration) JobOption {
+	return func(opts *JobOptions) error {
+		if err := validateTTL(ttl); err != nil {
+			return err
+		}
+		opts.ttlEnabled = true
+		opts.ttl = ttl
+		return nil
+	}
+}
+
+// WithJobTTLDisabled disables task handling deadline,
+// so that tasks could run until they finish
+func WithJobTTLDisabled() JobOption {
+	return func(opts *JobOptions) error {
+		opts.ttlEnabled = false
+		return nil
+	}
+}
+
+// WithJobMaxAttempts sets how many times task can be attempted
+// before it is moved to dead tasks. Zero means that task
+// will be requeued until it succeeds (default: 0)
+func WithJobMaxAttempts(attempts int) JobOption {
+	return func(opts *JobOptions) error {
+		if err := validateMaxAttempts(attempts); err != nil {
+			return err
+		}
+		opts.maxAttempts = attempts
+		return nil
+	}
+}
+
+// WithJobRetryPolicy sets policy that decides when failed task
+// will be attempted again. When set, it replaces requeue retries
+// and timeout (default: disabled)
+func WithJobRetryPolicy(policy RetryPolicy) JobOption {
+	return func(opts *JobOptions) error {
+		if err := validateRetryPolicy(policy); err != nil {
+			return err
+		}
+		opts.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithJobMiddleware appends middlewares that will wrap this job.
+// Job middlewares are applied after Manager middlewares
+// and are called in the same order as they were added
+func WithJobMiddleware(mws ...JobMiddleware) JobOption {
+	return func(opts *JobOptions) error {
+		for _, mw := range mws {
+			if err := validateJobMiddleware(mw); err != nil {
+				return err
+			}
+		}
+		opts.middlewares = append(opts.middlewares, mws...)
+		return nil
+	}
+}
+
+// WithJobBatchSize sets how many tasks of a batch job can be
+// claimed and handled at once (default: 1). Tasks of other jobs
+// are still claimed one by one. It is ignored for jobs
+// that are not batch jobs
+func WithJobBatchSize(n int) JobOption {
+	return func(opts *JobOptions) error {
+		if err := validateBatchSize(n); err != nil {
+			return err
+		}
+		opts.batchSize = n
+		return nil
+	}
+}
+
+// WithJobResultRetention sets how long results of result
+// job tasks are kept (default: 24h)
+func WithJobResultRetention(retention time.Duration) JobOption {
+	return func(opts *JobOptions) error {
+		if err := validateResultRetention(retention); err != nil {
+			return err
+		}
+		opts.resultTTL = retention
+		return nil
+	}
+}
+
+// QueueSubscription is a queue consumed by queue workers.
+// Queues with higher weight are checked for tasks more often
+type QueueSubscription struct {
+	Queue  string
+	Weight int
+}
+
+// QueueOptions contains all queue options
+type QueueOptions struct {
+	workerPoolSize int
+	subscriptions  []QueueSubscription
+	lease          time.Duration
+}
+
+func (opts QueueOptions) with(args ...QueueOption) (QueueOptions, error) {
+	for _, opt := range args {
+		if err := opt(&opts); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+var defaultQueueOptions = QueueOptions{
+	workerPoolSize: 1,
+}
+
+// QueueOption configures queue
+type QueueOption func(*QueueOptions) error
+
+// WithQueueWorkerPoolSize sets how many workers
+// should handle tasks of this queue (default: 1)
+func WithQueueWorkerPoolSize(size int) QueueOption {
+	return func(opts *QueueOptions) error {
+		if err := validatePoolSize(size); err != nil {
+			return err
+		}
+		opts.workerPoolSize = size
+		return nil
+	}
+}
+
+// WithQueueSubscription makes queue workers take tasks from another
+// queue as well. Queues with higher weight are checked more often.
+// Queue workers consume their own queue with weight 1 if no
+// subscriptions are set (default: no subscriptions)
+func WithQueueSubscription(queue string, weight int) QueueOption {
+	return func(opts *QueueOptions) error {
+		if err := firstError(
+			validateQueueName(queue),
+			validateQueueWeight(weight),
+		); err != nil {
+			return err
+		}
+		opts.subscriptions = append(opts.subscriptions, QueueSubscription{
+			Queue:  queue,
+			Weight: weight,
+		})
+		return nil
+	}
+}
+
+// WithQueueLease makes queue workers lease tasks instead of holding
+// a transaction and a connection open while tasks are handled.
+// Leases are extended while tasks run and tasks of expired leases
+// are returned to the queue (default: disabled)
+func WithQueueLease(lease time.Duration) QueueOption {
+	return func(opts *QueueOptions) error {
+		if err := validateLease(lease); err != nil {
+			return err
+		}
+		opts.lease = lease
+		return nil
+	}
+}
+
+// CatchUpPolicy defines how runs of a schedule that were
+// missed while no manager was running are queued
+type CatchUpPolicy int
+
+const (
+	// CatchUpSkip skips missed runs
+	CatchUpSkip CatchUpPolicy = iota
+	// CatchUpLatest queues a single task for the latest missed run
+	CatchUpLatest
+	// CatchUpAll queues a task for every missed run
+	CatchUpAll
+)
+
+// ScheduleOptions contains all schedule options
+type ScheduleOptions struct {
+	location    *time.Location
+	catchUp     CatchUpPolicy
+	taskOptions []TaskOption
+}
+
+func (opts ScheduleOptions) with(args ...ScheduleOption) (ScheduleOptions, error) {
+	for _, opt := range args {
+		if err := opt(&opts); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+var defaultScheduleOptions = ScheduleOptions{
+	location: time.UTC,
+	catchUp:  CatchUpSkip,
+}
+
+// ScheduleOption configures schedule
+type ScheduleOption func(*ScheduleOptions) error
+
+// WithScheduleTimezone sets IANA timezone, e.g. "Europe/Riga",
+// in which cron spec is evaluated (default: UTC)
+func WithScheduleTimezone(name string) ScheduleOption {
+	return func(opts *ScheduleOptions) error {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return ErrInvalidTimezone
+		}
+		opts.location = loc
+		return nil
+	}
+}
+
+// WithScheduleCatchUp sets how runs missed while no
+// manager was running are queued (default: CatchUpSkip)
+func WithScheduleCatchUp(policy CatchUpPolicy) ScheduleOption {
+	return func(opts *ScheduleOptions) error {
+		if err := validateCatchUpPolicy(policy); err != nil {
+			return err
+		}
+		opts.catchUp = policy
+		return nil
+	}
+}
+
+// WithScheduleTaskOptions sets options of queued tasks.
+// Task uid and start time are set by the schedule
+func WithScheduleTaskOptions(taskOpts ...TaskOption) ScheduleOption {
+	return func(opts *ScheduleOptions) error {
+		opts.taskOptions = append(opts.taskOptions, taskOpts...)
+		return nil
+	}
+}
+
+// UniqueScope defines tasks among which task unique key has to be unique
+type UniqueScope int
+
+const (
+	// UniqueScopeJob makes key unique among tasks of the same job
+	UniqueScopeJob UniqueScope = iota
+	// UniqueScopeQueue makes key unique among tasks of the same queue
+	UniqueScopeQueue
+	// UniqueScopeGlobal makes key unique among all tasks
+	UniqueScopeGlobal
+)
+
 // TaskOptions contains all task options
 type TaskOptions struct {
 	startAt        time.Time
 	startAtEnabled bool
 	retries        int
+	retryPolicy    *backoffPolicy
+	ttlEnabled     bool
+	ttl            time.Duration
+	ttlOverridden  bool
+	headers        taskHeaders
+	priority       int
+	queue          string
+	uniqueKey      string
+	uniqueScope    UniqueScope
+	uid            string
+	metrics        Metrics
 }
 
 var defaultTaskOptions = TaskOptions{
@@ -113,6 +529,29 @@ func (opts TaskOptions) with(args ...TaskOption) (TaskOptions, error) {
 	return opts, nil
 }
 
+// setHeader sets header without modifying
+// headers of options it was copied from
+func (opts *TaskOptions) setHeader(key, value string) {
+	headers := taskHeaders(opts.headers.copy())
+	headers[key] = value
+	opts.headers = headers
+}
+
+// nullTTL returns ttl that is stored with task.
+// Zero duration means that ttl is disabled
+func (opts TaskOptions) nullTTL() nullDuration {
+	if !opts.ttlOverridden {
+		return nullDuration{}
+	}
+	if !opts.ttlEnabled {
+		return nullDuration{Valid: true}
+	}
+	return nullDuration{
+		Valid:    true,
+		Duration: opts.ttl,
+	}
+}
+
 // WithTaskStartTime enables and sets time when task should be executed (default: disabled)
 func WithTaskStartTime(t time.Time) TaskOption {
 	return func(opts *TaskOptions) error {
@@ -143,3 +582,139 @@ func WithTaskRetries(retries int) TaskOption {
 		return nil
 	}
 }
+
+// WithTaskRetryPolicy overrides job retry policy for this task.
+// Only built-in retry policies can be used, since policy is
+// stored with the task (default: disabled)
+func WithTaskRetryPolicy(policy BuiltinRetryPolicy) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := validateTaskRetryPolicy(policy); err != nil {
+			return err
+		}
+		opts.retryPolicy = policy.builtin()
+		return nil
+	}
+}
+
+// WithTaskTTL overrides job ttl for this task (default: job ttl)
+func WithTaskTTL(ttl time.Duration) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := validateTTL(ttl); err != nil {
+			return err
+		}
+		opts.ttlOverridden = true
+		opts.ttlEnabled = true
+		opts.ttl = ttl
+		return nil
+	}
+}
+
+// WithTaskTTLDisabled disables handling deadline for this task
+func WithTaskTTLDisabled() TaskOption {
+	return func(opts *TaskOptions) error {
+		opts.ttlOverridden = true
+		opts.ttlEnabled = false
+		return nil
+	}
+}
+
+// WithTaskPriority sets task priority. Tasks with higher priority
+// are handled first, tasks with equal priority are handled
+// in the order they were queued (default: 0)
+func WithTaskPriority(priority int) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := validatePriority(priority); err != nil {
+			return err
+		}
+		opts.priority = priority
+		return nil
+	}
+}
+
+// WithTaskMetrics counts task in metrics of the producer when it is
+// queued, e.g. using metrics.Collector (default: disabled)
+func WithTaskMetrics(metrics Metrics) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := validateMetrics(metrics); err != nil {
+			return err
+		}
+		opts.metrics = metrics
+		return nil
+	}
+}
+
+// WithTaskQueue sets queue that task is pushed to (default: job name).
+// Task is only handled by managers that register or subscribe to the
+// queue. Managers log a warning when ready tasks of their jobs wait
+// in queues they do not subscribe to for longer than 5 minutes
+func WithTaskQueue(name string) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := validateQueueName(name); err != nil {
+			return err
+		}
+		opts.queue = name
+		return nil
+	}
+}
+
+// WithTaskUID sets task uid, so that task would be addressable by
+// caller's identifier, e.g. order or event ID. Queueing a task with
+// the same uid as pending or running task fails with ErrDuplicateTask.
+// Progress and result of a finished task with the same uid are cleared
+// (default: random UUID)
+func WithTaskUID(uid string) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := validateTaskUID(uid); err != nil {
+			return err
+		}
+		opts.uid = uid
+		return nil
+	}
+}
+
+// WithTaskUniqueKey makes queueing a no-op if a pending or running task
+// with the same key exists in the given scope. PreparedTask.UID returns
+// uid of the existing task when task is queued using DBQueryer.
+// Queueing using DBExecer waits while a task with the same key
+// is being handled in transaction claim mode
+func WithTaskUniqueKey(key string, scope UniqueScope) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := firstError(
+			validateUniqueKey(key),
+			validateUniqueScope(scope),
+		); err != nil {
+			return err
+		}
+		opts.uniqueKey = key
+		opts.uniqueScope = scope
+		return nil
+	}
+}
+
+// WithTaskHeader sets metadata header (e.g. tenant or correlation ID)
+// that travels with task separately from it's body
+func WithTaskHeader(key, value string) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := validateTaskHeader(key); err != nil {
+			return err
+		}
+		opts.setHeader(key, value)
+		return nil
+	}
+}
+
+// WithTaskTraceContext stores trace context of ctx (e.g. W3C traceparent
+// and baggage) with task, so that it would be restored when task is handled
+func WithTaskTraceContext(ctx context.Context, propagator Propagator) TaskOption {
+	return func(opts *TaskOptions) error {
+		if err := validatePropagator(propagator); err != nil {
+			return err
+		}
+		carrier := make(taskHeaders)
+		propagator.Inject(ctx, carrier)
+		for key, value := range carrier {
+			opts.setHeader(key, value)
+		}
+		return nil
+	}
+}
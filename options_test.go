@@ -1,6 +1,9 @@
 package jobq
 
 import (
+	"errors"
+	"math"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -218,3 +221,606 @@ func TestWithJobWorkerPoolSize(t *testing.T) {
 		})
 	}
 }
+
+func TestWithJobMiddleware(t *testing.T) {
+	mw := func(job Job) Job {
+		return job
+	}
+	tests := []struct {
+		name    string
+		opts    JobOptions
+		mws     []JobMiddleware
+		wantLen int
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			opts:    JobOptions{},
+			mws:     []JobMiddleware{mw, mw},
+			wantLen: 2,
+			wantErr: false,
+		},
+		{
+			name: "append",
+			opts: JobOptions{
+				middlewares: []JobMiddleware{mw},
+			},
+			mws:     []JobMiddleware{mw},
+			wantLen: 2,
+			wantErr: false,
+		},
+		{
+			name:    "nil",
+			opts:    JobOptions{},
+			mws:     []JobMiddleware{mw, nil},
+			wantLen: 0,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WithJobMiddleware(tt.mws...)(&tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithJobMiddleware(). got err = %v, wantErr = %v", err, tt.wantErr)
+				return
+			}
+			if got := len(tt.opts.middlewares); got != tt.wantLen {
+				t.Errorf("WithJobMiddleware() len(opts.middlewares) = %v, want %v", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestWithJobMaxAttempts(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            JobOptions
+		attempts        int
+		wantMaxAttempts int
+		wantErr         bool
+	}{
+		{
+			name:            "valid",
+			opts:            JobOptions{},
+			attempts:        10,
+			wantMaxAttempts: 10,
+			wantErr:         false,
+		},
+		{
+			name: "unlimited",
+			opts: JobOptions{
+				maxAttempts: 10,
+			},
+			attempts:        0,
+			wantMaxAttempts: 0,
+			wantErr:         false,
+		},
+		{
+			name: "invalid",
+			opts: JobOptions{
+				maxAttempts: 10,
+			},
+			attempts:        -1,
+			wantMaxAttempts: 10,
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WithJobMaxAttempts(tt.attempts)(&tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithJobMaxAttempts(). got err = %v, wantErr = %v", err, tt.wantErr)
+				return
+			}
+			if got := tt.opts.maxAttempts; got != tt.wantMaxAttempts {
+				t.Errorf("WithJobMaxAttempts() opts.maxAttempts = %v, want %v", got, tt.wantMaxAttempts)
+			}
+		})
+	}
+}
+
+type mockRetryPolicy struct{}
+
+func (mockRetryPolicy) NextRetry(int, error) (time.Time, bool) {
+	return time.Now(), true
+}
+
+func TestWithJobRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		wantErr bool
+	}{
+		{
+			name:    "built_in",
+			policy:  ConstantRetryPolicy(time.Second, 5),
+			wantErr: false,
+		},
+		{
+			name:    "custom",
+			policy:  mockRetryPolicy{},
+			wantErr: false,
+		},
+		{
+			name:    "nil",
+			policy:  nil,
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			policy:  ExponentialRetryPolicy(time.Second, time.Minute, 2, 5),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := JobOptions{}
+			err := WithJobRetryPolicy(tt.policy)(&opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithJobRetryPolicy(). got err = %v, wantErr = %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && opts.retryPolicy != tt.policy {
+				t.Errorf("WithJobRetryPolicy() opts.retryPolicy = %v, want %v", opts.retryPolicy, tt.policy)
+			}
+		})
+	}
+}
+
+func TestWithTaskRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  BuiltinRetryPolicy
+		wantErr bool
+	}{
+		{
+			name:    "built_in",
+			policy:  FibonacciRetryPolicy(time.Second, time.Minute, 5),
+			wantErr: false,
+		},
+		{
+			name:    "nil",
+			policy:  nil,
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			policy:  LinearRetryPolicy(0, time.Second, 5),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := TaskOptions{}
+			err := WithTaskRetryPolicy(tt.policy)(&opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithTaskRetryPolicy(). got err = %v, wantErr = %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && opts.retryPolicy != tt.policy {
+				t.Errorf("WithTaskRetryPolicy() opts.retryPolicy = %v, want %v", opts.retryPolicy, tt.policy)
+			}
+		})
+	}
+}
+
+func TestWithJobTTL(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           JobOptions
+		ttl            time.Duration
+		wantTTL        time.Duration
+		wantTTLEnabled bool
+		wantErr        bool
+	}{
+		{
+			name:           "valid",
+			opts:           JobOptions{},
+			ttl:            time.Minute,
+			wantTTL:        time.Minute,
+			wantTTLEnabled: true,
+			wantErr:        false,
+		},
+		{
+			name:    "invalid",
+			opts:    JobOptions{},
+			ttl:     0,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WithJobTTL(tt.ttl)(&tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithJobTTL(). got err = %v, wantErr = %v", err, tt.wantErr)
+				return
+			}
+			if got := tt.opts.ttl; got != tt.wantTTL {
+				t.Errorf("WithJobTTL() opts.ttl = %v, want %v", got, tt.wantTTL)
+			}
+			if got := tt.opts.ttlEnabled; got != tt.wantTTLEnabled {
+				t.Errorf("WithJobTTL() opts.ttlEnabled = %v, want %v", got, tt.wantTTLEnabled)
+			}
+		})
+	}
+}
+
+func TestWithJobTTLDisabled(t *testing.T) {
+	opts := JobOptions{
+		ttlEnabled: true,
+	}
+	if err := WithJobTTLDisabled()(&opts); err != nil {
+		t.Errorf("WithJobTTLDisabled(). got err = %v", err)
+	}
+	if opts.ttlEnabled {
+		t.Errorf("WithJobTTLDisabled() opts.ttlEnabled = %v, want %v", opts.ttlEnabled, false)
+	}
+}
+
+func TestTaskOptions_nullTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []TaskOption
+		want nullDuration
+	}{
+		{
+			name: "default",
+			opts: nil,
+			want: nullDuration{},
+		},
+		{
+			name: "ttl",
+			opts: []TaskOption{
+				WithTaskTTL(time.Minute),
+			},
+			want: nullDuration{
+				Valid:    true,
+				Duration: time.Minute,
+			},
+		},
+		{
+			name: "disabled",
+			opts: []TaskOption{
+				WithTaskTTL(time.Minute),
+				WithTaskTTLDisabled(),
+			},
+			want: nullDuration{
+				Valid: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := defaultTaskOptions.with(tt.opts...)
+			if err != nil {
+				t.Fatalf("TaskOptions.with() error = %v", err)
+			}
+			if got := opts.nullTTL(); got != tt.want {
+				t.Errorf("TaskOptions.nullTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTaskTTL(t *testing.T) {
+	opts := TaskOptions{}
+	if err := WithTaskTTL(0)(&opts); err != ErrInvalidTTL {
+		t.Errorf("WithTaskTTL(). got err = %v, want %v", err, ErrInvalidTTL)
+	}
+	if opts.ttlOverridden {
+		t.Errorf("WithTaskTTL() opts.ttlOverridden = %v, want %v", opts.ttlOverridden, false)
+	}
+}
+
+func TestWithManagerLogger(t *testing.T) {
+	logger := new(mockLogger)
+	opts, err := defaultManagerOptions.with(WithManagerLogger(logger))
+	if err != nil || opts.logger != logger {
+		t.Errorf("WithManagerLogger() logger = %v, err = %v, want %v", opts.logger, err, logger)
+	}
+	if _, err = defaultManagerOptions.with(WithManagerLogger(nil)); err != ErrInvalidLogger {
+		t.Errorf("WithManagerLogger(nil) error = %v, want %v", err, ErrInvalidLogger)
+	}
+}
+
+func TestWithManagerMetrics(t *testing.T) {
+	metrics := new(mockMetrics)
+	opts, err := defaultManagerOptions.with(WithManagerMetrics(metrics))
+	if err != nil || opts.metrics != metrics {
+		t.Errorf("WithManagerMetrics() metrics = %v, err = %v, want %v", opts.metrics, err, metrics)
+	}
+	if _, err = defaultManagerOptions.with(WithManagerMetrics(nil)); err != ErrInvalidMetrics {
+		t.Errorf("WithManagerMetrics(nil) error = %v, want %v", err, ErrInvalidMetrics)
+	}
+}
+
+func TestWithTaskMetrics(t *testing.T) {
+	metrics := new(mockMetrics)
+	opts, err := defaultTaskOptions.with(WithTaskMetrics(metrics))
+	if err != nil || opts.metrics != metrics {
+		t.Errorf("WithTaskMetrics() metrics = %v, err = %v, want %v", opts.metrics, err, metrics)
+	}
+	if _, err = defaultTaskOptions.with(WithTaskMetrics(nil)); err != ErrInvalidMetrics {
+		t.Errorf("WithTaskMetrics(nil) error = %v, want %v", err, ErrInvalidMetrics)
+	}
+}
+
+func TestWithManagerTracing(t *testing.T) {
+	if _, err := defaultManagerOptions.with(WithManagerPropagator(nil)); err != ErrInvalidPropagator {
+		t.Errorf("WithManagerPropagator(nil) error = %v, want %v", err, ErrInvalidPropagator)
+	}
+	if _, err := defaultManagerOptions.with(WithManagerTracer(nil)); err != ErrInvalidTracer {
+		t.Errorf("WithManagerTracer(nil) error = %v, want %v", err, ErrInvalidTracer)
+	}
+}
+
+func TestWithManagerErrorHandler(t *testing.T) {
+	var got error
+	opts, err := defaultManagerOptions.with(WithManagerErrorHandler(func(err error) {
+		got = err
+	}))
+	if err != nil {
+		t.Fatalf("WithManagerErrorHandler() error = %v", err)
+	}
+	want := errors.New("test err")
+	opts.errorHandler(want)
+	if got != want {
+		t.Errorf("WithManagerErrorHandler() handled err = %v, want %v", got, want)
+	}
+}
+
+func TestWithTaskPriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority int
+		want     int
+		wantErr  error
+	}{
+		{
+			name:     "high",
+			priority: 10,
+			want:     10,
+		},
+		{
+			name:     "low",
+			priority: -10,
+			want:     -10,
+		},
+		{
+			name:     "overflow",
+			priority: math.MaxInt32 + 1,
+			wantErr:  ErrInvalidPriority,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := TaskOptions{}
+			if err := WithTaskPriority(tt.priority)(&opts); err != tt.wantErr {
+				t.Errorf("WithTaskPriority() error = %v, want %v", err, tt.wantErr)
+			}
+			if opts.priority != tt.want {
+				t.Errorf("WithTaskPriority() opts.priority = %v, want %v", opts.priority, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithManagerPriorityAging(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     time.Duration
+		wantErr  error
+	}{
+		{
+			name:     "minute",
+			interval: time.Minute,
+			want:     time.Minute,
+		},
+		{
+			name:     "disabled",
+			interval: 0,
+			want:     0,
+		},
+		{
+			name:     "negative",
+			interval: -time.Minute,
+			wantErr:  ErrInvalidPriorityAging,
+		},
+		{
+			name:     "too_short",
+			interval: time.Microsecond,
+			wantErr:  ErrInvalidPriorityAging,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ManagerOptions{}
+			if err := WithManagerPriorityAging(tt.interval)(&opts); err != tt.wantErr {
+				t.Errorf("WithManagerPriorityAging() error = %v, want %v", err, tt.wantErr)
+			}
+			if opts.priorityAging != tt.want {
+				t.Errorf("WithManagerPriorityAging() opts.priorityAging = %v, want %v", opts.priorityAging, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithManagerDrainTimeout(t *testing.T) {
+	opts, err := defaultManagerOptions.with(WithManagerDrainTimeout(time.Minute))
+	if err != nil || opts.drainTimeout != time.Minute {
+		t.Errorf("WithManagerDrainTimeout() drainTimeout = %v, err = %v, want %v", opts.drainTimeout, err, time.Minute)
+	}
+	if _, err = defaultManagerOptions.with(WithManagerDrainTimeout(-time.Minute)); err != ErrInvalidDrainTimeout {
+		t.Errorf("WithManagerDrainTimeout() error = %v, want %v", err, ErrInvalidDrainTimeout)
+	}
+}
+
+func TestWithManagerHistory(t *testing.T) {
+	opts, err := defaultManagerOptions.with(WithManagerHistory(time.Hour))
+	if err != nil || !opts.history || opts.historyRetention != time.Hour {
+		t.Errorf("WithManagerHistory() history = %v, historyRetention = %v, err = %v, want true, %v", opts.history, opts.historyRetention, err, time.Hour)
+	}
+	if _, err = defaultManagerOptions.with(WithManagerHistory(-time.Hour)); err != ErrInvalidRetention {
+		t.Errorf("WithManagerHistory() error = %v, want %v", err, ErrInvalidRetention)
+	}
+}
+
+func TestWithQueueSubscription(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   string
+		weight  int
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			queue:  "critical",
+			weight: 3,
+		},
+		{
+			name:    "invalid_queue",
+			queue:   "Critical!",
+			weight:  3,
+			wantErr: ErrInvalidQueueName,
+		},
+		{
+			name:    "invalid_weight",
+			queue:   "critical",
+			weight:  0,
+			wantErr: ErrInvalidQueueWeight,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := defaultQueueOptions.with(WithQueueSubscription(tt.queue, tt.weight))
+			if err != tt.wantErr {
+				t.Errorf("WithQueueSubscription() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(opts.subscriptions, []QueueSubscription{{tt.queue, tt.weight}}) {
+				t.Errorf("WithQueueSubscription() subscriptions = %v", opts.subscriptions)
+			}
+		})
+	}
+}
+
+func TestWithTaskQueue(t *testing.T) {
+	opts := TaskOptions{}
+	if err := WithTaskQueue("bulk")(&opts); err != nil || opts.queue != "bulk" {
+		t.Errorf("WithTaskQueue() queue = %v, error = %v, want %v", opts.queue, err, "bulk")
+	}
+	if err := WithTaskQueue("")(&opts); err != ErrInvalidQueueName {
+		t.Errorf("WithTaskQueue() error = %v, want %v", err, ErrInvalidQueueName)
+	}
+}
+
+func TestWithTaskUniqueKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		scope   UniqueScope
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			key:   "order-1",
+			scope: UniqueScopeQueue,
+		},
+		{
+			name:    "empty_key",
+			scope:   UniqueScopeJob,
+			wantErr: ErrInvalidUniqueKey,
+		},
+		{
+			name:    "invalid_scope",
+			key:     "order-1",
+			scope:   UniqueScope(10),
+			wantErr: ErrInvalidUniqueScope,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := TaskOptions{}
+			if err := WithTaskUniqueKey(tt.key, tt.scope)(&opts); err != tt.wantErr {
+				t.Errorf("WithTaskUniqueKey() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithJobBatchSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		want    int
+		wantErr error
+	}{
+		{
+			name: "valid",
+			n:    100,
+			want: 100,
+		},
+		{
+			name:    "zero",
+			n:       0,
+			want:    1,
+			wantErr: ErrInvalidBatchSize,
+		},
+		{
+			name:    "too_large",
+			n:       maxBatchRows + 1,
+			want:    1,
+			wantErr: ErrInvalidBatchSize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := defaultJobOptions.with(WithJobBatchSize(tt.n))
+			if err != tt.wantErr {
+				t.Errorf("WithJobBatchSize() error = %v, want %v", err, tt.wantErr)
+			}
+			if opts.batchSize != tt.want {
+				t.Errorf("WithJobBatchSize() opts.batchSize = %v, want %v", opts.batchSize, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithQueueLease(t *testing.T) {
+	opts, err := defaultQueueOptions.with(WithQueueLease(time.Minute))
+	if err != nil {
+		t.Fatalf("WithQueueLease() error = %v", err)
+	}
+	if opts.lease != time.Minute {
+		t.Errorf("WithQueueLease() opts.lease = %v, want %v", opts.lease, time.Minute)
+	}
+	if _, err = defaultQueueOptions.with(WithQueueLease(time.Millisecond)); err != ErrInvalidLease {
+		t.Errorf("WithQueueLease() error = %v, want %v", err, ErrInvalidLease)
+	}
+}
+
+func TestWithJobResultRetention(t *testing.T) {
+	opts, err := defaultJobOptions.with(WithJobResultRetention(time.Hour))
+	if err != nil {
+		t.Fatalf("WithJobResultRetention() error = %v", err)
+	}
+	if opts.resultTTL != time.Hour {
+		t.Errorf("WithJobResultRetention() opts.resultTTL = %v, want %v", opts.resultTTL, time.Hour)
+	}
+	if _, err = defaultJobOptions.with(WithJobResultRetention(0)); err != ErrInvalidResultRetention {
+		t.Errorf("WithJobResultRetention() error = %v, want %v", err, ErrInvalidResultRetention)
+	}
+}
+
+func TestWithScheduleCatchUp(t *testing.T) {
+	opts, err := defaultScheduleOptions.with(WithScheduleCatchUp(CatchUpAll))
+	if err != nil {
+		t.Fatalf("WithScheduleCatchUp() error = %v", err)
+	}
+	if opts.catchUp != CatchUpAll {
+		t.Errorf("WithScheduleCatchUp() opts.catchUp = %v, want %v", opts.catchUp, CatchUpAll)
+	}
+	if _, err = defaultScheduleOptions.with(WithScheduleCatchUp(CatchUpPolicy(-1))); err != ErrInvalidCatchUpPolicy {
+		t.Errorf("WithScheduleCatchUp() error = %v, want %v", err, ErrInvalidCatchUpPolicy)
+	}
+}
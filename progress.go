@@ -0,0 +1,87 @@
+package jobq
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTaskNotHandled is returned when progress is reported
+	// for a task that is not handled by a worker
+	ErrTaskNotHandled = errors.New("task is not handled by a worker")
+)
+
+// TaskState is a state of a task in it's lifecycle
+type TaskState string
+
+const (
+	// TaskQueued is a task waiting in the queue
+	TaskQueued TaskState = "queued"
+	// TaskRunning is a task claimed by a worker
+	TaskRunning TaskState = "running"
+	// TaskFinished is a task that was handled and removed from the queue
+	TaskFinished TaskState = "finished"
+	// TaskDead is a task that was moved to dead tasks
+	TaskDead TaskState = "dead"
+	// TaskCanceled is a task that was canceled by Client.Cancel
+	TaskCanceled TaskState = "canceled"
+	// TaskFailed is a failed task that was dropped,
+	// since it's job does not requeue failed tasks
+	TaskFailed TaskState = "failed"
+)
+
+// progressRetention is how long progress of finished
+// and dead tasks is kept, same as default result retention
+const progressRetention = time.Hour * 24
+
+// TaskStatus is a state and last reported progress of a task
+type TaskStatus struct {
+	uid       string
+	state     TaskState
+	percent   float64
+	message   string
+	updatedAt nullTime
+}
+
+// UID returns unique identifier of the task
+func (s *TaskStatus) UID() string {
+	return s.uid
+}
+
+// State returns state of the task
+func (s *TaskStatus) State() TaskState {
+	return s.state
+}
+
+// Progress returns last reported progress in percent
+func (s *TaskStatus) Progress() float64 {
+	return s.percent
+}
+
+// Message returns message of the last reported progress
+func (s *TaskStatus) Message() string {
+	return s.message
+}
+
+// UpdatedAt returns time when progress was last reported.
+// Zero time is returned if progress was never reported
+func (s *TaskStatus) UpdatedAt() time.Time {
+	return s.updatedAt.Time
+}
+
+// ReportProgress stores progress of the task, so that it could be
+// looked up by Client.TaskStatus. Progress is stored outside of
+// the dequeue transaction and is visible immediately
+func (tsk *Task) ReportProgress(percent float64, message string) error {
+	if err := validateProgress(percent); err != nil {
+		return err
+	}
+	if tsk.store == nil {
+		return ErrTaskNotHandled
+	}
+	s, ok := tsk.store.(progressStore)
+	if !ok {
+		return ErrNotSupported
+	}
+	return s.ReportProgress(tsk.row.uid, percent, message)
+}
@@ -0,0 +1,124 @@
+package jobq
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTask_ReportProgress(t *testing.T) {
+	var gotUID, gotMessage string
+	var gotPercent float64
+	task := &Task{
+		row: &TaskRow{uid: "import-1"},
+		store: &mockStore{
+			onReportProgress: func(uid string, percent float64, message string) error {
+				gotUID, gotPercent, gotMessage = uid, percent, message
+				return nil
+			},
+		},
+	}
+	if err := task.ReportProgress(42, "importing rows"); err != nil {
+		t.Fatalf("Task.ReportProgress() error = %v", err)
+	}
+	if gotUID != "import-1" || gotPercent != 42 || gotMessage != "importing rows" {
+		t.Errorf("Task.ReportProgress() stored %v %v %v", gotUID, gotPercent, gotMessage)
+	}
+	for _, percent := range []float64{-1, 101} {
+		if err := task.ReportProgress(percent, ""); err != ErrInvalidProgress {
+			t.Errorf("Task.ReportProgress(%v) error = %v, want %v", percent, err, ErrInvalidProgress)
+		}
+	}
+	task.store = nil
+	if err := task.ReportProgress(42, ""); err != ErrTaskNotHandled {
+		t.Errorf("Task.ReportProgress() error = %v, want %v", err, ErrTaskNotHandled)
+	}
+}
+
+func Test_upsertTaskProgress(t *testing.T) {
+	execer := &mockDBExecer{
+		wantStmt: `
+			INSERT INTO jobq_task_progress (uid, percent, message, updated_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (uid) DO UPDATE SET
+				percent = EXCLUDED.percent,
+				message = EXCLUDED.message,
+				updated_at = EXCLUDED.updated_at;
+		`,
+		wantArgs: []interface{}{"import-1", 42.0, "importing rows"},
+	}
+	if err := upsertTaskProgress(execer, "import-1", 42, "importing rows"); err != nil {
+		t.Fatalf("upsertTaskProgress() error = %v", err)
+	}
+	if !execer.valid {
+		t.Errorf("upsertTaskProgress() gotStmt = %s, wantStmt = %s", execer.gotStmt, execer.wantStmt)
+		t.Errorf("upsertTaskProgress() gotArgs = %v, wantArgs = %v", execer.gotArgs, execer.wantArgs)
+	}
+}
+
+func TestClient_TaskStatus(t *testing.T) {
+	want := &TaskStatus{uid: "import-1", state: TaskRunning, percent: 42}
+	c := &Client{
+		store: &mockStore{
+			onTaskStatus: func(uid string) (*TaskStatus, error) {
+				if uid != "import-1" {
+					return nil, ErrTaskNotFound
+				}
+				return want, nil
+			},
+		},
+	}
+	got, err := c.TaskStatus("import-1")
+	if err != nil {
+		t.Fatalf("Client.TaskStatus() error = %v", err)
+	}
+	if got.State() != TaskRunning || got.Progress() != 42 || !got.UpdatedAt().IsZero() {
+		t.Errorf("Client.TaskStatus() = %v, want %v", got, want)
+	}
+	if _, err = c.TaskStatus("other"); err != ErrTaskNotFound {
+		t.Errorf("Client.TaskStatus() error = %v, want %v", err, ErrTaskNotFound)
+	}
+}
+
+func Test_selectTaskStatus(t *testing.T) {
+	queryer := &mockDBQueryer{wantErr: true}
+	if _, err := selectTaskStatus(queryer, "import-1"); err == nil {
+		t.Fatalf("selectTaskStatus() error = nil, want query error")
+	}
+	if strings.Contains(queryer.gotStmt, "FOR KEY SHARE") || !strings.Contains(queryer.gotStmt, "pg_locks") {
+		t.Errorf("selectTaskStatus() locks rows instead of checking pg_locks: %s", queryer.gotStmt)
+	}
+	if strings.Contains(queryer.gotStmt, "xmax") || !strings.Contains(queryer.gotStmt, "l.locktype = 'advisory'") ||
+		!strings.Contains(queryer.gotStmt, fmt.Sprintf("l.classid::bigint = %d", taskLockKey)) {
+		t.Errorf("selectTaskStatus() does not check advisory locks of claimed tasks: %s", queryer.gotStmt)
+	}
+	if !strings.Contains(queryer.gotStmt, "jobq_task_history") || !strings.Contains(queryer.gotStmt, "'canceled'") {
+		t.Errorf("selectTaskStatus() does not check canceled task history: %s", queryer.gotStmt)
+	}
+	if !reflect.DeepEqual(queryer.gotArgs, []interface{}{"import-1"}) {
+		t.Errorf("selectTaskStatus() gotArgs = %v, want [import-1]", queryer.gotArgs)
+	}
+}
+
+func Test_purgeTaskProgress(t *testing.T) {
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	execer := &mockDBExecer{
+		wantStmt: `
+			DELETE FROM jobq_task_progress p
+			WHERE p.updated_at < $1
+			AND NOT EXISTS (SELECT 1 FROM jobq_tasks t WHERE t.uid = p.uid);
+		`,
+		wantArgs: []interface{}{before},
+		affected: 2,
+	}
+	n, err := purgeTaskProgress(execer, before)
+	if err != nil {
+		t.Fatalf("purgeTaskProgress() error = %v", err)
+	}
+	if !execer.valid || n != 2 {
+		t.Errorf("purgeTaskProgress() gotStmt = %s, wantStmt = %s", execer.gotStmt, execer.wantStmt)
+		t.Errorf("purgeTaskProgress() gotArgs = %v, wantArgs = %v, purged %d", execer.gotArgs, execer.wantArgs, n)
+	}
+}
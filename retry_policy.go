@@ -0,0 +1,174 @@
+package jobq
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides when a failed task should be attempted again.
+// NextRetry receives number of attempts made so far and error of the
+// last attempt and returns time of the next attempt or false if
+// task should not be retried anymore
+type RetryPolicy interface {
+	NextRetry(attempt int, err error) (time.Time, bool)
+}
+
+// BuiltinRetryPolicy is a retry policy returned by one of built-in
+// retry policy constructors. Unlike custom policies, it can be stored
+// with a task, so only built-in policies can be set per task
+type BuiltinRetryPolicy interface {
+	RetryPolicy
+	builtin() *backoffPolicy
+}
+
+const (
+	backoffConstant    = "constant"
+	backoffLinear      = "linear"
+	backoffExponential = "exponential"
+	backoffFibonacci   = "fibonacci"
+)
+
+// backoffPolicy implements built-in retry policies.
+// It is stored as JSON, so that it could be set per task
+type backoffPolicy struct {
+	Kind        string        `json:"kind"`
+	Initial     time.Duration `json:"initial"`
+	Step        time.Duration `json:"step,omitempty"`
+	Max         time.Duration `json:"max,omitempty"`
+	Jitter      float64       `json:"jitter,omitempty"`
+	MaxAttempts int           `json:"max_attempts,omitempty"`
+}
+
+// ConstantRetryPolicy retries task after the same delay every time.
+// Zero maxAttempts means that task will be retried forever
+func ConstantRetryPolicy(delay time.Duration, maxAttempts int) BuiltinRetryPolicy {
+	return &backoffPolicy{
+		Kind:        backoffConstant,
+		Initial:     delay,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// LinearRetryPolicy retries task after initial delay
+// increased by step after each attempt.
+// Zero maxAttempts means that task will be retried forever
+func LinearRetryPolicy(initial, step time.Duration, maxAttempts int) BuiltinRetryPolicy {
+	return &backoffPolicy{
+		Kind:        backoffLinear,
+		Initial:     initial,
+		Step:        step,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// ExponentialRetryPolicy retries task after initial delay doubled
+// after each attempt and limited by max (zero means no limit).
+// Jitter (0 to 1) randomly reduces delay by up to given fraction,
+// so that failed tasks would not be retried at the same time.
+// Zero maxAttempts means that task will be retried forever
+func ExponentialRetryPolicy(initial, max time.Duration, jitter float64, maxAttempts int) BuiltinRetryPolicy {
+	return &backoffPolicy{
+		Kind:        backoffExponential,
+		Initial:     initial,
+		Max:         max,
+		Jitter:      jitter,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// FibonacciRetryPolicy retries task after initial delay multiplied
+// by fibonacci number of an attempt and limited by max (zero means no limit).
+// Zero maxAttempts means that task will be retried forever
+func FibonacciRetryPolicy(initial, max time.Duration, maxAttempts int) BuiltinRetryPolicy {
+	return &backoffPolicy{
+		Kind:        backoffFibonacci,
+		Initial:     initial,
+		Max:         max,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+func (p *backoffPolicy) builtin() *backoffPolicy {
+	return p
+}
+
+// NextRetry returns time of the next attempt
+func (p *backoffPolicy) NextRetry(attempt int, err error) (time.Time, bool) {
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return time.Time{}, false
+	}
+	return time.Now().Add(p.delay(attempt)), true
+}
+
+func (p *backoffPolicy) delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	var d time.Duration
+	switch p.Kind {
+	case backoffLinear:
+		d = p.Initial + p.Step*time.Duration(attempt-1)
+	case backoffExponential:
+		d = p.Initial
+		for i := 1; i < attempt && !p.exceeds(d); i++ {
+			d *= 2
+		}
+	case backoffFibonacci:
+		prev := time.Duration(0)
+		d = p.Initial
+		for i := 1; i < attempt && !p.exceeds(d); i++ {
+			prev, d = d, prev+d
+		}
+	default:
+		d = p.Initial
+	}
+	d = p.limit(d)
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// exceeds reports whether d reached max delay or is about to overflow
+func (p *backoffPolicy) exceeds(d time.Duration) bool {
+	if p.Max > 0 && d >= p.Max {
+		return true
+	}
+	return d > math.MaxInt64/2
+}
+
+func (p *backoffPolicy) limit(d time.Duration) time.Duration {
+	if p.Max > 0 && d > p.Max {
+		return p.Max
+	}
+	return d
+}
+
+// nullRetryPolicy stores built-in retry policy of a task
+type nullRetryPolicy struct {
+	Policy *backoffPolicy
+}
+
+func (np *nullRetryPolicy) Scan(value interface{}) error {
+	np.Policy = nil
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	policy := new(backoffPolicy)
+	if err := json.Unmarshal(b, policy); err != nil {
+		return err
+	}
+	np.Policy = policy
+	return nil
+}
+
+func (np nullRetryPolicy) Value() (driver.Value, error) {
+	if np.Policy == nil {
+		return nil, nil
+	}
+	return json.Marshal(np.Policy)
+}
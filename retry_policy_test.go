@@ -0,0 +1,163 @@
+package jobq
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_backoffPolicy_delay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{
+			name:   "constant",
+			policy: ConstantRetryPolicy(time.Second, 0),
+			want: []time.Duration{
+				time.Second,
+				time.Second,
+				time.Second,
+			},
+		},
+		{
+			name:   "linear",
+			policy: LinearRetryPolicy(time.Second, time.Second*2, 0),
+			want: []time.Duration{
+				time.Second,
+				time.Second * 3,
+				time.Second * 5,
+			},
+		},
+		{
+			name:   "exponential",
+			policy: ExponentialRetryPolicy(time.Second, time.Second*10, 0, 0),
+			want: []time.Duration{
+				time.Second,
+				time.Second * 2,
+				time.Second * 4,
+				time.Second * 8,
+				time.Second * 10,
+				time.Second * 10,
+			},
+		},
+		{
+			name:   "fibonacci",
+			policy: FibonacciRetryPolicy(time.Second, time.Second*10, 0),
+			want: []time.Duration{
+				time.Second,
+				time.Second,
+				time.Second * 2,
+				time.Second * 3,
+				time.Second * 5,
+				time.Second * 8,
+				time.Second * 10,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy.(*backoffPolicy)
+			got := []time.Duration{}
+			for attempt := 1; attempt <= len(tt.want); attempt++ {
+				got = append(got, p.delay(attempt))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("backoffPolicy.delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_backoffPolicy_delay_jitter(t *testing.T) {
+	p := ExponentialRetryPolicy(time.Second, time.Minute, 0.5, 0).(*backoffPolicy)
+	for i := 0; i < 100; i++ {
+		got := p.delay(3)
+		if got < time.Second*2 || got > time.Second*4 {
+			t.Fatalf("backoffPolicy.delay() = %v, want between %v and %v", got, time.Second*2, time.Second*4)
+		}
+	}
+}
+
+func Test_backoffPolicy_delay_overflow(t *testing.T) {
+	policies := []RetryPolicy{
+		ExponentialRetryPolicy(time.Duration(1<<62), 0, 0, 0),
+		ExponentialRetryPolicy(time.Nanosecond, 0, 0, 0),
+		FibonacciRetryPolicy(time.Duration(1<<62), 0, 0),
+		FibonacciRetryPolicy(time.Nanosecond, 0, 0),
+	}
+	for _, policy := range policies {
+		p := policy.(*backoffPolicy)
+		for _, attempt := range []int{2, 3, 64, 100} {
+			if got := p.delay(attempt); got <= 0 {
+				t.Errorf("backoffPolicy.delay(%d) of %v = %v, want positive delay", attempt, p.Initial, got)
+			}
+		}
+	}
+}
+
+func Test_backoffPolicy_NextRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		wantOk  bool
+	}{
+		{
+			name:    "unlimited",
+			policy:  ConstantRetryPolicy(time.Second, 0),
+			attempt: 1000,
+			wantOk:  true,
+		},
+		{
+			name:    "attempts_left",
+			policy:  ConstantRetryPolicy(time.Second, 3),
+			attempt: 2,
+			wantOk:  true,
+		},
+		{
+			name:    "give_up",
+			policy:  ConstantRetryPolicy(time.Second, 3),
+			attempt: 3,
+			wantOk:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			next, ok := tt.policy.NextRetry(tt.attempt, errors.New("test err"))
+			if ok != tt.wantOk {
+				t.Errorf("backoffPolicy.NextRetry() ok = %v, want %v", ok, tt.wantOk)
+				return
+			}
+			if ok && next.Before(before.Add(time.Second)) {
+				t.Errorf("backoffPolicy.NextRetry() = %v, want after %v", next, before.Add(time.Second))
+			}
+		})
+	}
+}
+
+func Test_nullRetryPolicy(t *testing.T) {
+	want := nullRetryPolicy{
+		Policy: ExponentialRetryPolicy(time.Second, time.Minute, 0.5, 10).(*backoffPolicy),
+	}
+	value, err := want.Value()
+	if err != nil {
+		t.Fatalf("nullRetryPolicy.Value() error = %v", err)
+	}
+	got := nullRetryPolicy{}
+	if err = got.Scan(value); err != nil {
+		t.Fatalf("nullRetryPolicy.Scan() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nullRetryPolicy.Scan() = %v, want %v", got.Policy, want.Policy)
+	}
+	if err = got.Scan(nil); err != nil || got.Policy != nil {
+		t.Errorf("nullRetryPolicy.Scan(nil) = %v, error = %v", got.Policy, err)
+	}
+	if value, err = got.Value(); err != nil || value != nil {
+		t.Errorf("nullRetryPolicy.Value() = %v, error = %v", value, err)
+	}
+}
@@ -0,0 +1,118 @@
+package jobq
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// scheduleInterval is how often managers check schedules
+	scheduleInterval = time.Second * 10
+	// scheduleLookahead is how early runs are queued. Tasks
+	// of runs are queued ahead with their start time set
+	scheduleLookahead = scheduleInterval * 3
+)
+
+// BodyFactory returns body of a task queued for a scheduled run
+type BodyFactory func(runAt time.Time) (Valuer, error)
+
+// schedule queues tasks of a job at times of a cron spec
+type schedule struct {
+	name    string
+	spec    string
+	cron    *cronSchedule
+	jobName string
+	body    BodyFactory
+	opts    ScheduleOptions
+}
+
+// next returns the first run after t
+func (s *schedule) next(t time.Time) time.Time {
+	return s.cron.next(t.In(s.opts.location))
+}
+
+// row returns stored schedule with the first run after now
+func (s *schedule) row(now time.Time) *ScheduleRow {
+	next := s.next(now)
+	return &ScheduleRow{
+		name:     s.name,
+		jobName:  s.jobName,
+		spec:     s.spec,
+		timezone: s.opts.location.String(),
+		nextRunAt: nullTime{
+			Valid: !next.IsZero(),
+			Time:  next.UTC(),
+		},
+	}
+}
+
+// dueRuns returns runs from next until given time and the run after them.
+// Runs before missedBefore were missed and are queued by catch up policy
+func (s *schedule) dueRuns(next, missedBefore, until time.Time) ([]time.Time, time.Time) {
+	var runs []time.Time
+	var missed time.Time
+	for !next.IsZero() && !next.After(until) && len(runs) < maxBatchRows {
+		if next.Before(missedBefore) && s.opts.catchUp != CatchUpAll {
+			missed = next
+		} else {
+			runs = append(runs, next)
+		}
+		next = s.next(next)
+	}
+	if !missed.IsZero() && s.opts.catchUp == CatchUpLatest {
+		runs = append([]time.Time{missed}, runs...)
+	}
+	return runs, next
+}
+
+// task returns task row of a run. Task uid is made of schedule name and
+// run time, so that the same run would not be queued twice. Start time
+// is set on the row, since WithTaskStartTime rejects runs that are due
+func (s *schedule) task(runAt time.Time) (*TaskRow, error) {
+	body, err := s.body(runAt)
+	if err != nil {
+		return nil, err
+	}
+	uid := fmt.Sprintf("%s:%s", s.name, runAt.UTC().Format(time.RFC3339))
+	opts := make([]TaskOption, 0, len(s.opts.taskOptions)+1)
+	opts = append(opts, s.opts.taskOptions...)
+	opts = append(opts, WithTaskUID(uid))
+	task, err := NewTask(s.jobName, body, opts...)
+	if err != nil {
+		return nil, err
+	}
+	row, err := task.row()
+	if err != nil {
+		return nil, err
+	}
+	row.startAt = nullTime{
+		Valid: true,
+		Time:  runAt.UTC(),
+	}
+	return row, nil
+}
+
+// queue queues tasks of due runs and moves next run of the schedule
+func (s *schedule) queue(act ScheduleAction, row *ScheduleRow, missedBefore, until time.Time) ([]time.Time, error) {
+	runs, next := s.dueRuns(row.nextRunAt.Time, missedBefore, until)
+	for _, runAt := range runs {
+		task, err := s.task(runAt)
+		if err != nil {
+			return nil, err
+		}
+		if err = act.Queue(task); err != nil {
+			return nil, err
+		}
+	}
+	if len(runs) > 0 {
+		row.lastRunAt = nullTime{
+			Valid: true,
+			Time:  runs[len(runs)-1].UTC(),
+		}
+	}
+	row.nextRunAt = nullTime{
+		Valid: !next.IsZero(),
+		Time:  next.UTC(),
+	}
+	return runs, act.Advance(row)
+}
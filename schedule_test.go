@@ -0,0 +1,162 @@
+package jobq
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type mockScheduleAction struct {
+	rows     []*ScheduleRow
+	queued   []*TaskRow
+	advanced []*ScheduleRow
+	errQueue error
+}
+
+func (act *mockScheduleAction) Commit() error {
+	return nil
+}
+func (act *mockScheduleAction) Rollback() error {
+	return nil
+}
+func (act *mockScheduleAction) Queue(row *TaskRow) error {
+	act.queued = append(act.queued, row)
+	return act.errQueue
+}
+func (act *mockScheduleAction) Advance(row *ScheduleRow) error {
+	act.advanced = append(act.advanced, row)
+	return nil
+}
+func (act *mockScheduleAction) Savepoint(f func() error) error {
+	queued, advanced := len(act.queued), len(act.advanced)
+	if err := f(); err != nil {
+		act.queued, act.advanced = act.queued[:queued], act.advanced[:advanced]
+		return err
+	}
+	return nil
+}
+func (act *mockScheduleAction) Rows() []*ScheduleRow {
+	return act.rows
+}
+
+// testSchedule returns schedule that runs every 10 minutes
+func testSchedule(t *testing.T, opts ...ScheduleOption) *schedule {
+	cron, err := parseCron("*/10 * * * *")
+	if err != nil {
+		t.Fatalf("parseCron() error = %v", err)
+	}
+	options, err := defaultScheduleOptions.with(opts...)
+	if err != nil {
+		t.Fatalf("ScheduleOptions.with() error = %v", err)
+	}
+	return &schedule{
+		name:    "report",
+		spec:    "*/10 * * * *",
+		cron:    cron,
+		jobName: "send_report",
+		body: func(runAt time.Time) (Valuer, error) {
+			return mockBody{[]byte(`{}`)}, nil
+		},
+		opts: options,
+	}
+}
+
+func Test_schedule_dueRuns(t *testing.T) {
+	at := func(min int) time.Time {
+		return time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC).Add(time.Duration(min) * time.Minute)
+	}
+	tests := []struct {
+		name     string
+		policy   CatchUpPolicy
+		next     time.Time
+		want     []time.Time
+		wantNext time.Time
+	}{
+		{
+			name:     "on_time",
+			policy:   CatchUpSkip,
+			next:     at(60),
+			want:     []time.Time{at(60)},
+			wantNext: at(70),
+		},
+		{
+			name:     "skip_missed",
+			policy:   CatchUpSkip,
+			next:     at(0),
+			want:     []time.Time{at(60)},
+			wantNext: at(70),
+		},
+		{
+			name:     "latest_missed",
+			policy:   CatchUpLatest,
+			next:     at(0),
+			want:     []time.Time{at(50), at(60)},
+			wantNext: at(70),
+		},
+		{
+			name:     "all_missed",
+			policy:   CatchUpAll,
+			next:     at(30),
+			want:     []time.Time{at(30), at(40), at(50), at(60)},
+			wantNext: at(70),
+		},
+		{
+			name:     "not_due",
+			policy:   CatchUpSkip,
+			next:     at(70),
+			want:     nil,
+			wantNext: at(70),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testSchedule(t, WithScheduleCatchUp(tt.policy))
+			runs, next := s.dueRuns(tt.next, at(55), at(65))
+			if !reflect.DeepEqual(runs, tt.want) {
+				t.Errorf("schedule.dueRuns() runs = %v, want %v", runs, tt.want)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("schedule.dueRuns() next = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func Test_schedule_queue(t *testing.T) {
+	s := testSchedule(t, WithScheduleTaskOptions(WithTaskPriority(5)))
+	now := time.Now()
+	next := s.next(now)
+	row := &ScheduleRow{
+		name:      s.name,
+		nextRunAt: nullTime{Valid: true, Time: next.UTC()},
+	}
+	act := &mockScheduleAction{}
+	runs, err := s.queue(act, row, now, next)
+	if err != nil {
+		t.Fatalf("schedule.queue() error = %v", err)
+	}
+	if len(runs) != 1 || len(act.queued) != 1 {
+		t.Fatalf("schedule.queue() runs = %v, queued %d tasks, want 1 run", runs, len(act.queued))
+	}
+	task := act.queued[0]
+	wantUID := "report:" + next.UTC().Format(time.RFC3339)
+	if task.uid != wantUID || task.jobName != "send_report" || task.priority != 5 {
+		t.Errorf("schedule.queue() task uid = %v, job = %v, priority = %v, want %v, send_report, 5", task.uid, task.jobName, task.priority, wantUID)
+	}
+	if !task.startAt.Valid || !task.startAt.Time.Equal(next) {
+		t.Errorf("schedule.queue() task start at = %v, want %v", task.startAt.Time, next)
+	}
+	if len(act.advanced) != 1 || !row.lastRunAt.Time.Equal(next) || !row.nextRunAt.Time.Equal(s.next(next)) {
+		t.Errorf("schedule.queue() last run = %v, next run = %v, want %v, %v", row.lastRunAt.Time, row.nextRunAt.Time, next, s.next(next))
+	}
+	errQueue := errors.New("queue err")
+	act = &mockScheduleAction{errQueue: errQueue}
+	row.nextRunAt = nullTime{Valid: true, Time: next.UTC()}
+	if _, err = s.queue(act, row, now, next); err != errQueue {
+		t.Errorf("schedule.queue() error = %v, want %v", err, errQueue)
+	}
+	if len(act.advanced) != 0 {
+		t.Errorf("schedule.queue() advanced schedule after queue error")
+	}
+}
@@ -1,14 +1,40 @@
 package jobq
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 )
 
 var (
-	ErrEmptyQueue = errors.New("queue is empty")
+	ErrEmptyQueue   = errors.New("queue is empty")
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrDuplicateTask is returned when task with the same uid
+	// or unique key is already queued
+	ErrDuplicateTask = errors.New("task already exists")
+	// ErrLeaseLost is returned when lease of a task expired
+	// and task was returned to the queue before it was committed
+	ErrLeaseLost = errors.New("task lease lost")
+	// ErrTaskDead is returned when result is awaited
+	// for a task that was moved to dead tasks
+	ErrTaskDead = errors.New("task is dead")
+	// ErrTaskCanceled is returned when result is awaited
+	// for a task that was canceled by Client.Cancel
+	ErrTaskCanceled = errors.New("task is canceled")
+	// ErrCancelPending is returned when cancel of a claimed task was
+	// recorded but no worker acknowledged it yet. Recorded cancel is
+	// applied when task is started or it's lease is reaped
+	ErrCancelPending = errors.New("task cancel is pending")
+	// ErrNoDueSchedules is returned when schedules have no due runs
+	// or are claimed by another manager
+	ErrNoDueSchedules = errors.New("no due schedules")
+	// ErrNotSupported is returned when a feature is used with a custom
+	// Store or TaskAction that does not implement it
+	ErrNotSupported = errors.New("not supported by store")
 )
 
 func uuid() string {
@@ -22,15 +48,28 @@ func uuid() string {
 }
 
 type TaskRow struct {
-	id      int64
-	uid     string
-	jobName string
-	body    []byte
-	retries int
-	timeout nullTime
-	startAt nullTime
+	id              int64
+	uid             string
+	jobName         string
+	body            []byte
+	retries         int
+	attempts        int
+	timeout         nullTime
+	startAt         nullTime
+	retryPolicy     nullRetryPolicy
+	lastError       string
+	createdAt       nullTime
+	lastAttemptedAt nullTime
+	ttl             nullDuration
+	headers         taskHeaders
+	priority        int
+	queue           string
+	uniqueKey       sql.NullString
 }
 
+// TaskAction finishes claimed tasks. Features added later are
+// optional interfaces that are checked when they are used, so that
+// existing implementations would keep working
 type TaskAction interface {
 	Commit() error
 	Rollback() error
@@ -38,9 +77,46 @@ type TaskAction interface {
 	Row() *TaskRow
 }
 
+// batchAction is implemented by task actions that claim many tasks
+type batchAction interface {
+	Rows() []*TaskRow
+}
+
+// buryAction is implemented by task actions that move
+// tasks with no more attempts left to dead tasks
+type buryAction interface {
+	Bury(*TaskRow, error) error
+}
+
+// resultAction is implemented by task actions that store results of result jobs
+type resultAction interface {
+	SaveResult(row *TaskRow, result []byte, retention time.Duration) error
+}
+
+// archiveAction is implemented by task actions that keep finished tasks in task history
+type archiveAction interface {
+	Archive(row *TaskRow, status TaskState, worker string, duration time.Duration) error
+}
+
+// cancelAction is implemented by task actions that cancel tasks canceled by Client.Cancel
+type cancelAction interface {
+	// Canceled returns ids of claimed tasks that have cancel requests
+	Canceled() (map[int64]bool, error)
+	// Cancel keeps task in history as canceled and acknowledges it's cancel request
+	Cancel(row *TaskRow, worker string, duration time.Duration) error
+}
+
+// actionRows returns tasks claimed by act
+func actionRows(act TaskAction) []*TaskRow {
+	if b, ok := act.(batchAction); ok {
+		return b.Rows()
+	}
+	return []*TaskRow{act.Row()}
+}
+
 type taskAction struct {
-	tx Tx
-	r  *TaskRow
+	tx   Tx
+	rows []*TaskRow
 }
 
 func (act taskAction) Commit() error {
@@ -55,25 +131,418 @@ func (act taskAction) Requeue(row *TaskRow) error {
 	return requeueTask(act.tx, row)
 }
 
+func (act taskAction) Bury(row *TaskRow, reason error) error {
+	return buryTask(act.tx, row, reason.Error())
+}
+
+func (act taskAction) SaveResult(row *TaskRow, result []byte, retention time.Duration) error {
+	return upsertTaskResult(act.tx, row, result, retention)
+}
+
+func (act taskAction) Archive(row *TaskRow, status TaskState, worker string, duration time.Duration) error {
+	return insertTaskHistory(act.tx, row, status, worker, duration)
+}
+
+func (act taskAction) Canceled() (map[int64]bool, error) {
+	return selectTaskCancels(act.tx, taskIDs(act.rows))
+}
+
+func (act taskAction) Cancel(row *TaskRow, worker string, duration time.Duration) error {
+	if err := insertTaskHistory(act.tx, row, TaskCanceled, worker, duration); err != nil {
+		return err
+	}
+	return deleteTaskCancel(act.tx, row.id)
+}
+
+// Row returns the first dequeued task
 func (act taskAction) Row() *TaskRow {
-	return act.r
+	return act.rows[0]
+}
+
+// Rows returns all tasks dequeued in the transaction
+func (act taskAction) Rows() []*TaskRow {
+	return act.rows
+}
+
+// leaseAction handles tasks leased by a worker. Leased tasks stay
+// in the queue locked by the worker, so no transaction is held open
+// while they are handled. Leases are extended until action is finished
+type leaseAction struct {
+	db       DB
+	owner    string
+	lease    time.Duration
+	rows     []*TaskRow
+	ids      []int64
+	requeued map[int64]bool
+	buried   map[int64]string
+	results  map[int64]taskResult
+	history  map[int64]historyRecord
+	canceled map[int64]bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     bool
+	mu       sync.Mutex
+	handling context.Context
+	// cancel cancels handling context and onError
+	// reports leases that could not be extended
+	cancel   context.CancelFunc
+	onError  func(error)
+	extended time.Time
+}
+
+// taskResult is a result of a leased task saved on commit
+type taskResult struct {
+	body      []byte
+	retention time.Duration
+}
+
+// historyRecord is a history entry of a leased task saved on commit
+type historyRecord struct {
+	status   TaskState
+	worker   string
+	duration time.Duration
+}
+
+// leaseKeeper is implemented by task actions that keep
+// tasks claimed only while they are being handled
+type leaseKeeper interface {
+	// keepWhile keeps leases while ctx is not done. Errors of
+	// extending leases are passed to onError and ctx is canceled
+	// using cancel once leases are lost or expired
+	keepWhile(ctx context.Context, cancel context.CancelFunc, onError func(error))
+}
+
+// taskIDs returns ids of task rows
+func taskIDs(rows []*TaskRow) []int64 {
+	ids := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.id)
+	}
+	return ids
+}
+
+func newLeaseAction(db DB, owner string, lease time.Duration, rows []*TaskRow) *leaseAction {
+	return &leaseAction{
+		db:       db,
+		owner:    owner,
+		lease:    lease,
+		rows:     rows,
+		ids:      taskIDs(rows),
+		requeued: make(map[int64]bool),
+		buried:   make(map[int64]string),
+		results:  make(map[int64]taskResult),
+		history:  make(map[int64]historyRecord),
+		canceled: make(map[int64]bool),
+		stop:     make(chan struct{}),
+		extended: time.Now(),
+	}
+}
+
+// heartbeat extends leases every third of lease duration while
+// tasks are handled. Leases of stuck handlers are left to expire,
+// so that their tasks are recovered. Handling is canceled once
+// leases could not be extended before they expired
+func (act *leaseAction) heartbeat() {
+	ticker := time.NewTicker(act.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-act.stop:
+			return
+		case <-ticker.C:
+			if act.alive() {
+				act.extend()
+			}
+		}
+	}
+}
+
+// extend extends leases and reports leases that could not be extended
+func (act *leaseAction) extend() {
+	n, err := extendLeases(act.db, act.ids, act.owner, act.lease)
+	if err == nil && n < int64(len(act.ids)) {
+		err = ErrLeaseLost
+	}
+	act.mu.Lock()
+	defer act.mu.Unlock()
+	if err == nil {
+		act.extended = time.Now()
+		return
+	}
+	if act.onError != nil {
+		act.onError(err)
+	}
+	if act.cancel != nil && (err == ErrLeaseLost || time.Since(act.extended) >= act.lease) {
+		act.cancel()
+	}
+}
+
+func (act *leaseAction) keepWhile(ctx context.Context, cancel context.CancelFunc, onError func(error)) {
+	act.mu.Lock()
+	defer act.mu.Unlock()
+	act.handling = ctx
+	act.cancel = cancel
+	act.onError = onError
+}
+
+// alive reports whether leased tasks are still being handled
+func (act *leaseAction) alive() bool {
+	act.mu.Lock()
+	defer act.mu.Unlock()
+	return act.handling == nil || act.handling.Err() == nil
+}
+
+func (act *leaseAction) stopHeartbeat() {
+	act.stopOnce.Do(func() {
+		close(act.stop)
+	})
+}
+
+// Commit deletes handled tasks and requeues or buries failed ones
+// in one transaction. It fails with ErrLeaseLost if any of the
+// leases has expired and was reaped
+func (act *leaseAction) Commit() error {
+	act.stopHeartbeat()
+	tx, err := act.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, row := range act.rows {
+		ok, err := deleteLeasedTask(tx, row.id, act.owner)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrLeaseLost
+		}
+		if act.requeued[row.id] {
+			err = requeueTask(tx, row)
+		} else if reason, ok := act.buried[row.id]; ok {
+			err = buryTask(tx, row, reason)
+		} else if result, ok := act.results[row.id]; ok {
+			err = upsertTaskResult(tx, row, result.body, result.retention)
+		}
+		if err != nil {
+			return err
+		}
+		if h, ok := act.history[row.id]; ok {
+			if err = insertTaskHistory(tx, row, h.status, h.worker, h.duration); err != nil {
+				return err
+			}
+		}
+		if act.canceled[row.id] {
+			if err = deleteTaskCancel(tx, row.id); err != nil {
+				return err
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	act.done = true
+	return nil
+}
+
+// Rollback releases leases of tasks that were not committed
+func (act *leaseAction) Rollback() error {
+	act.stopHeartbeat()
+	if act.done {
+		return nil
+	}
+	act.done = true
+	return releaseLeases(act.db, act.ids, act.owner)
+}
+
+func (act *leaseAction) Requeue(row *TaskRow) error {
+	act.requeued[row.id] = true
+	return nil
+}
+
+func (act *leaseAction) Bury(row *TaskRow, reason error) error {
+	act.buried[row.id] = reason.Error()
+	return nil
+}
+
+func (act *leaseAction) SaveResult(row *TaskRow, result []byte, retention time.Duration) error {
+	act.results[row.id] = taskResult{
+		body:      result,
+		retention: retention,
+	}
+	return nil
+}
+
+func (act *leaseAction) Archive(row *TaskRow, status TaskState, worker string, duration time.Duration) error {
+	act.history[row.id] = historyRecord{
+		status:   status,
+		worker:   worker,
+		duration: duration,
+	}
+	return nil
+}
+
+func (act *leaseAction) Canceled() (map[int64]bool, error) {
+	return selectTaskCancels(act.db, act.ids)
+}
+
+func (act *leaseAction) Cancel(row *TaskRow, worker string, duration time.Duration) error {
+	act.canceled[row.id] = true
+	return act.Archive(row, TaskCanceled, worker, duration)
+}
+
+// Row returns the first leased task
+func (act *leaseAction) Row() *TaskRow {
+	return act.rows[0]
+}
+
+// Rows returns all leased tasks
+func (act *leaseAction) Rows() []*TaskRow {
+	return act.rows
+}
+
+// ScheduleRow is a stored schedule of recurring tasks
+type ScheduleRow struct {
+	name      string
+	jobName   string
+	spec      string
+	timezone  string
+	nextRunAt nullTime
+	lastRunAt nullTime
+}
+
+// ScheduleAction queues tasks of due schedules
+// and moves their next runs in one transaction
+type ScheduleAction interface {
+	Commit() error
+	Rollback() error
+	Queue(row *TaskRow) error
+	Advance(row *ScheduleRow) error
+	// Savepoint runs f in a savepoint, so that changes of a failed
+	// schedule are rolled back without rolling back other schedules
+	Savepoint(f func() error) error
+	Rows() []*ScheduleRow
+}
+
+type scheduleAction struct {
+	tx   Tx
+	rows []*ScheduleRow
 }
 
+func (act scheduleAction) Commit() error {
+	return act.tx.Commit()
+}
+
+func (act scheduleAction) Rollback() error {
+	return act.tx.Rollback()
+}
+
+func (act scheduleAction) Queue(row *TaskRow) error {
+	return queueTask(act.tx, row)
+}
+
+func (act scheduleAction) Advance(row *ScheduleRow) error {
+	return updateScheduleRuns(act.tx, row)
+}
+
+func (act scheduleAction) Savepoint(f func() error) error {
+	return inSavepoint(act.tx, "jobq_schedule", f)
+}
+
+// Rows returns due schedules locked by the transaction
+func (act scheduleAction) Rows() []*ScheduleRow {
+	return act.rows
+}
+
+// Store claims and queues tasks. Features added later are optional
+// interfaces that are checked when they are used, so that existing
+// implementations would keep working
 type Store interface {
-	Dequeue(name string) (TaskAction, error)
+	Dequeue(queue string, jobNames []string, limit int) (TaskAction, error)
 	Queue(row *TaskRow) error
 }
 
+// leaseStore is implemented by stores that lease tasks
+type leaseStore interface {
+	Lease(queue string, jobNames []string, limit int, owner string, lease time.Duration) (TaskAction, error)
+	ReapLeases() (map[string]int, error)
+}
+
+// progressStore is implemented by stores that keep progress of tasks
+type progressStore interface {
+	ReportProgress(uid string, percent float64, message string) error
+	TaskStatus(uid string) (*TaskStatus, error)
+	PurgeProgress(before time.Time) (int64, error)
+}
+
+// resultStore is implemented by stores that keep results of result jobs
+type resultStore interface {
+	TaskResult(uid string) ([]byte, error)
+	PurgeResults() (int64, error)
+}
+
+// historyStore is implemented by stores that keep task history
+type historyStore interface {
+	TaskHistory(uid string) ([]*HistoryEntry, error)
+	PurgeHistory(before time.Time) (int64, error)
+	PurgeCanceledHistory(before time.Time) (int64, error)
+}
+
+// cancelStore is implemented by stores that cancel tasks
+type cancelStore interface {
+	Cancel(uid string) error
+	CancelPending(uid string) (bool, error)
+	PurgeCancels(before time.Time) (int64, error)
+}
+
+// scheduleStore is implemented by stores that keep schedules
+type scheduleStore interface {
+	SaveSchedule(row *ScheduleRow) error
+	ClaimSchedules(names []string, until time.Time) (ScheduleAction, error)
+}
+
+// deadTaskStore is implemented by stores that keep dead tasks
+type deadTaskStore interface {
+	DeadTasks(jobName string, limit, offset int) ([]*DeadTask, error)
+	DeadTask(uid string) (*DeadTask, error)
+	RequeueDeadTask(uid string) error
+	PurgeDeadTasks(jobName string, before time.Time) (int64, error)
+}
+
+// depthStore is implemented by stores that count pending tasks of queues
+type depthStore interface {
+	QueueDepths(queues []string) (map[string]map[string]int, error)
+	StrandedTasks(jobNames, queues []string, age time.Duration) (map[string]map[string]int, error)
+}
+
+// managerStore is a store with all features. Manager and Client
+// always use the built-in store, custom stores are only used
+// by workers of custom worker factories
+type managerStore interface {
+	Store
+	leaseStore
+	progressStore
+	resultStore
+	historyStore
+	cancelStore
+	scheduleStore
+	deadTaskStore
+	depthStore
+}
+
 type store struct {
 	db DB
+	// priorityAging raises priority of waiting tasks by 1
+	// every interval. Zero disables aging
+	priorityAging time.Duration
 }
 
-func (s store) Dequeue(name string) (TaskAction, error) {
+// Dequeue claims up to limit tasks of the queue in one transaction
+func (s store) Dequeue(queue string, jobNames []string, limit int) (TaskAction, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
-	row, err := dequeueTask(tx, name)
+	rows, err := dequeueTasks(tx, queue, jobNames, limit, s.priorityAging)
 	if err == sql.ErrNoRows {
 		tx.Rollback()
 		return nil, ErrEmptyQueue
@@ -82,11 +551,226 @@ func (s store) Dequeue(name string) (TaskAction, error) {
 		return nil, err
 	}
 	return &taskAction{
-		tx: tx,
-		r:  row,
+		tx:   tx,
+		rows: rows,
+	}, nil
+}
+
+// Lease locks up to limit tasks of the queue by owner without
+// holding a transaction open. Locked tasks are returned to the
+// queue by ReapLeases when their lease expires
+func (s store) Lease(queue string, jobNames []string, limit int, owner string, lease time.Duration) (TaskAction, error) {
+	rows, err := leaseTasks(s.db, queue, jobNames, limit, owner, lease, s.priorityAging)
+	if err == sql.ErrNoRows {
+		return nil, ErrEmptyQueue
+	} else if err != nil {
+		return nil, err
+	}
+	act := newLeaseAction(s.db, owner, lease, rows)
+	go act.heartbeat()
+	return act, nil
+}
+
+// ReapLeases returns tasks with expired leases to their queues
+// and reports how many tasks were returned to each queue.
+// Tasks with cancel requests are canceled instead
+func (s store) ReapLeases() (map[string]int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	canceled, err := deleteCanceledLeases(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range canceled {
+		if err = insertTaskHistory(tx, row, TaskCanceled, "", 0); err != nil {
+			return nil, err
+		}
+	}
+	reaped, err := reapLeases(tx)
+	if err != nil {
+		return nil, err
+	}
+	return reaped, tx.Commit()
+}
+
+func (s store) ReportProgress(uid string, percent float64, message string) error {
+	return upsertTaskProgress(s.db, uid, percent, message)
+}
+
+func (s store) TaskStatus(uid string) (*TaskStatus, error) {
+	status, err := selectTaskStatus(s.db, uid)
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+	return status, err
+}
+
+// TaskResult returns stored result of a task
+func (s store) TaskResult(uid string) ([]byte, error) {
+	body, err := selectTaskResult(s.db, uid)
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+	return body, err
+}
+
+// PurgeResults deletes results that are kept longer than their retention
+func (s store) PurgeResults() (int64, error) {
+	return purgeTaskResults(s.db)
+}
+
+// PurgeProgress deletes progress of finished and dead tasks
+// that was last reported before given time
+func (s store) PurgeProgress(before time.Time) (int64, error) {
+	return purgeTaskProgress(s.db, before)
+}
+
+// TaskHistory returns history entries of a task, oldest first
+func (s store) TaskHistory(uid string) ([]*HistoryEntry, error) {
+	return selectTaskHistory(s.db, uid)
+}
+
+// PurgeHistory deletes history entries of tasks finished before given time
+func (s store) PurgeHistory(before time.Time) (int64, error) {
+	return purgeTaskHistory(s.db, before)
+}
+
+// PurgeCanceledHistory deletes history entries of tasks canceled before given time
+func (s store) PurgeCanceledHistory(before time.Time) (int64, error) {
+	return purgeCanceledTaskHistory(s.db, before)
+}
+
+// Cancel deletes queued task and keeps it in task history as canceled.
+// If task is claimed by a worker, cancel request is recorded, workers
+// are notified to cancel it and ErrCancelPending is returned
+func (s store) Cancel(uid string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	row, err := cancelQueuedTask(tx, uid)
+	if err == sql.ErrNoRows {
+		found, err := insertTaskCancel(tx, uid)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrTaskNotFound
+		}
+		if _, err = notifyTaskCanceled(tx, uid); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		return ErrCancelPending
+	} else if err != nil {
+		return err
+	} else if err = insertTaskHistory(tx, row, TaskCanceled, "", 0); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CancelPending reports whether cancel of a claimed task was not
+// acknowledged by a worker yet. ErrTaskNotFound is returned if task
+// left the queue without acknowledging it's cancel
+func (s store) CancelPending(uid string) (bool, error) {
+	pending, err := selectTaskCancelPending(s.db, uid)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err == nil && !pending {
+		return false, ErrTaskNotFound
+	}
+	return pending, err
+}
+
+// PurgeCancels deletes cancel requests of tasks
+// that left the queue before given time
+func (s store) PurgeCancels(before time.Time) (int64, error) {
+	return purgeTaskCancels(s.db, before)
+}
+
+// SaveSchedule creates schedule or updates existing one
+func (s store) SaveSchedule(row *ScheduleRow) error {
+	return upsertSchedule(s.db, row)
+}
+
+// ClaimSchedules locks schedules with runs due until given time. Only
+// one caller can claim schedules at a time, others get ErrNoDueSchedules
+// until it's transaction ends
+func (s store) ClaimSchedules(names []string, until time.Time) (ScheduleAction, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockSchedules(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !locked {
+		tx.Rollback()
+		return nil, ErrNoDueSchedules
+	}
+	rows, err := selectDueSchedules(tx, names, until)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, ErrNoDueSchedules
+	} else if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &scheduleAction{
+		tx:   tx,
+		rows: rows,
 	}, nil
 }
 
 func (s store) Queue(row *TaskRow) error {
 	return queueTask(s.db, row)
 }
+
+func (s store) DeadTasks(jobName string, limit, offset int) ([]*DeadTask, error) {
+	return selectDeadTasks(s.db, jobName, limit, offset)
+}
+
+func (s store) DeadTask(uid string) (*DeadTask, error) {
+	task, err := selectDeadTask(s.db, uid)
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+	return task, err
+}
+
+func (s store) RequeueDeadTask(uid string) error {
+	n, err := requeueDeadTask(s.db, uid)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+func (s store) PurgeDeadTasks(jobName string, before time.Time) (int64, error) {
+	return purgeDeadTasks(s.db, jobName, before)
+}
+
+// QueueDepths returns number of pending and running
+// tasks of the queues by queue and job name
+func (s store) QueueDepths(queues []string) (map[string]map[string]int, error) {
+	return countQueuedTasks(s.db, queues)
+}
+
+// StrandedTasks returns number of ready tasks of the jobs that are waiting
+// longer than age in queues other than given ones by queue and job name
+func (s store) StrandedTasks(jobNames, queues []string, age time.Duration) (map[string]map[string]int, error) {
+	return countStrandedTasks(s.db, jobNames, queues, age)
+}
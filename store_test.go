@@ -1,15 +1,26 @@
 package jobq
 
 import (
+	"database/sql"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type mockTaskAction struct {
-	errCommit   error
-	errRollback error
-	errRequeue  error
-	taskRow     *TaskRow
+	errCommit     error
+	errRollback   error
+	errRequeue    error
+	errBury       error
+	errSaveResult error
+	errArchive    error
+	buriedIDs     map[int64]bool
+	errCancel     error
+	canceledIDs   map[int64]bool
+	taskRow       *TaskRow
+	taskRows      []*TaskRow
 }
 
 func (act mockTaskAction) Commit() error {
@@ -22,24 +33,153 @@ func (act mockTaskAction) Requeue(*TaskRow) error {
 	return act.errRequeue
 
 }
+func (act mockTaskAction) Bury(row *TaskRow, _ error) error {
+	if act.buriedIDs != nil && act.errBury == nil {
+		act.buriedIDs[row.id] = true
+	}
+	return act.errBury
+}
+func (act mockTaskAction) SaveResult(*TaskRow, []byte, time.Duration) error {
+	return act.errSaveResult
+}
+func (act mockTaskAction) Archive(*TaskRow, TaskState, string, time.Duration) error {
+	return act.errArchive
+}
+func (act mockTaskAction) Canceled() (map[int64]bool, error) {
+	return act.canceledIDs, nil
+}
+func (act mockTaskAction) Cancel(*TaskRow, string, time.Duration) error {
+	return act.errCancel
+}
 func (act mockTaskAction) Row() *TaskRow {
 	return act.taskRow
 
 }
+func (act mockTaskAction) Rows() []*TaskRow {
+	if act.taskRows != nil {
+		return act.taskRows
+	}
+	return []*TaskRow{act.taskRow}
+}
 
 type mockStore struct {
-	onDequeue func(name string) (TaskAction, error)
-	onQueue   func(row *TaskRow) error
+	onDequeue         func(queue string, jobNames []string, limit int) (TaskAction, error)
+	onLease           func(queue string, jobNames []string, limit int, owner string, lease time.Duration) (TaskAction, error)
+	onReapLeases      func() (map[string]int, error)
+	onReportProgress  func(uid string, percent float64, message string) error
+	onTaskStatus      func(uid string) (*TaskStatus, error)
+	onTaskResult      func(uid string) ([]byte, error)
+	onPurgeResults    func() (int64, error)
+	onPurgeProgress   func(before time.Time) (int64, error)
+	onTaskHistory     func(uid string) ([]*HistoryEntry, error)
+	onPurgeHistory    func(before time.Time) (int64, error)
+	onPurgeCanceled   func(before time.Time) (int64, error)
+	onCancel          func(uid string) error
+	onCancelPending   func(uid string) (bool, error)
+	onPurgeCancels    func(before time.Time) (int64, error)
+	onSaveSchedule    func(row *ScheduleRow) error
+	onClaimSchedules  func(names []string, until time.Time) (ScheduleAction, error)
+	onQueue           func(row *TaskRow) error
+	onDeadTasks       func(jobName string, limit, offset int) ([]*DeadTask, error)
+	onDeadTask        func(uid string) (*DeadTask, error)
+	onRequeueDeadTask func(uid string) error
+	onPurgeDeadTasks  func(jobName string, before time.Time) (int64, error)
+	onQueueDepths     func(queues []string) (map[string]map[string]int, error)
+	onStrandedTasks   func(jobNames, queues []string, age time.Duration) (map[string]map[string]int, error)
+}
+
+func (store *mockStore) Dequeue(queue string, jobNames []string, limit int) (TaskAction, error) {
+	return store.onDequeue(queue, jobNames, limit)
+}
+
+func (store *mockStore) Lease(queue string, jobNames []string, limit int, owner string, lease time.Duration) (TaskAction, error) {
+	return store.onLease(queue, jobNames, limit, owner, lease)
+}
+
+func (store *mockStore) ReapLeases() (map[string]int, error) {
+	return store.onReapLeases()
+}
+
+func (store *mockStore) ReportProgress(uid string, percent float64, message string) error {
+	return store.onReportProgress(uid, percent, message)
+}
+
+func (store *mockStore) TaskStatus(uid string) (*TaskStatus, error) {
+	return store.onTaskStatus(uid)
+}
+
+func (store *mockStore) TaskResult(uid string) ([]byte, error) {
+	return store.onTaskResult(uid)
+}
+
+func (store *mockStore) PurgeResults() (int64, error) {
+	return store.onPurgeResults()
+}
+
+func (store *mockStore) PurgeProgress(before time.Time) (int64, error) {
+	return store.onPurgeProgress(before)
+}
+
+func (store *mockStore) TaskHistory(uid string) ([]*HistoryEntry, error) {
+	return store.onTaskHistory(uid)
+}
+
+func (store *mockStore) PurgeHistory(before time.Time) (int64, error) {
+	return store.onPurgeHistory(before)
+}
+
+func (store *mockStore) PurgeCanceledHistory(before time.Time) (int64, error) {
+	return store.onPurgeCanceled(before)
+}
+
+func (store *mockStore) Cancel(uid string) error {
+	return store.onCancel(uid)
+}
+
+func (store *mockStore) CancelPending(uid string) (bool, error) {
+	return store.onCancelPending(uid)
 }
 
-func (store *mockStore) Dequeue(name string) (TaskAction, error) {
-	return store.onDequeue(name)
+func (store *mockStore) PurgeCancels(before time.Time) (int64, error) {
+	return store.onPurgeCancels(before)
+}
+
+func (store *mockStore) SaveSchedule(row *ScheduleRow) error {
+	return store.onSaveSchedule(row)
+}
+
+func (store *mockStore) ClaimSchedules(names []string, until time.Time) (ScheduleAction, error) {
+	return store.onClaimSchedules(names, until)
 }
 
 func (store *mockStore) Queue(row *TaskRow) error {
 	return store.onQueue(row)
 }
 
+func (store *mockStore) DeadTasks(jobName string, limit, offset int) ([]*DeadTask, error) {
+	return store.onDeadTasks(jobName, limit, offset)
+}
+
+func (store *mockStore) DeadTask(uid string) (*DeadTask, error) {
+	return store.onDeadTask(uid)
+}
+
+func (store *mockStore) RequeueDeadTask(uid string) error {
+	return store.onRequeueDeadTask(uid)
+}
+
+func (store *mockStore) PurgeDeadTasks(jobName string, before time.Time) (int64, error) {
+	return store.onPurgeDeadTasks(jobName, before)
+}
+
+func (store *mockStore) QueueDepths(queues []string) (map[string]map[string]int, error) {
+	return store.onQueueDepths(queues)
+}
+
+func (store *mockStore) StrandedTasks(jobNames, queues []string, age time.Duration) (map[string]map[string]int, error) {
+	return store.onStrandedTasks(jobNames, queues, age)
+}
+
 func Test_storeImpl_queue(t *testing.T) {
 	type fields struct {
 		id      int64
@@ -73,14 +213,22 @@ func Test_storeImpl_queue(t *testing.T) {
 			execer: &mockDBExecer{
 				wantStmt: `
 					INSERT INTO jobq_tasks (
+						uid,
 						job_name,
 						body,
 						retries,
 						timeout,
-						start_at
-					) VALUES ($1, $2, $3, $4, $5);
+						start_at,
+						retry_policy,
+						ttl,
+						headers,
+						priority,
+						queue,
+						unique_key
+					) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
 				`,
 				wantArgs: []interface{}{
+					"",
 					"test-job-name",
 					[]byte{0, 1, 2, 3},
 					5,
@@ -92,6 +240,12 @@ func Test_storeImpl_queue(t *testing.T) {
 						Valid: true,
 						Time:  time.Unix(2000, 0),
 					},
+					nullRetryPolicy{},
+					nullDuration{},
+					taskHeaders(nil),
+					0,
+					"",
+					sql.NullString{},
 				},
 			},
 		},
@@ -107,7 +261,7 @@ func Test_storeImpl_queue(t *testing.T) {
 				startAt: tt.fields.startAt,
 			}
 			store := &store{
-				&mockDB{
+				db: &mockDB{
 					mockDBExecer: tt.execer,
 				},
 			}
@@ -157,18 +311,31 @@ func Test_taskActionImpl_requeue(t *testing.T) {
 				wantStmt: `
 					INSERT INTO jobq_tasks (
 						id,
+						uid,
 						job_name,
 						body,
 						retries,
+						attempts,
 						timeout,
-						start_at
-					) VALUES ($1, $2, $3, $4, $5, $6);
+						start_at,
+						retry_policy,
+						last_error,
+						created_at,
+						last_attempted_at,
+						ttl,
+						headers,
+						priority,
+						queue,
+						unique_key
+					) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17);
 				`,
 				wantArgs: []interface{}{
 					int64(100),
+					"",
 					"test-job-name",
 					[]byte{0, 1, 2, 3},
 					5,
+					0,
 					nullTime{
 						Valid: true,
 						Time:  time.Unix(1000, 0),
@@ -177,6 +344,15 @@ func Test_taskActionImpl_requeue(t *testing.T) {
 						Valid: true,
 						Time:  time.Unix(2000, 0),
 					},
+					nullRetryPolicy{},
+					"",
+					nullTime{},
+					nullTime{},
+					nullDuration{},
+					taskHeaders(nil),
+					0,
+					"",
+					sql.NullString{},
 				},
 			},
 		},
@@ -206,3 +382,205 @@ func Test_taskActionImpl_requeue(t *testing.T) {
 		})
 	}
 }
+
+func Test_taskActionImpl_bury(t *testing.T) {
+	type fields struct {
+		uid      string
+		jobName  string
+		body     []byte
+		retries  int
+		attempts int
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		reason  error
+		execer  *mockDBExecer
+		wantErr bool
+	}{
+		{
+			name: "success",
+			fields: fields{
+				uid:      "test-uid",
+				jobName:  "test-job-name",
+				body:     []byte{0, 1, 2, 3},
+				retries:  0,
+				attempts: 10,
+			},
+			reason: errors.New("test err"),
+			execer: &mockDBExecer{
+				wantStmt: `
+					INSERT INTO jobq_dead_tasks (
+						uid,
+						job_name,
+						body,
+						retries,
+						attempts,
+						last_error,
+						retry_policy,
+						created_at,
+						last_attempted_at,
+						ttl,
+						headers,
+						priority,
+						queue,
+						unique_key
+					) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+					ON CONFLICT (uid) DO UPDATE SET
+						job_name = EXCLUDED.job_name,
+						body = EXCLUDED.body,
+						retries = EXCLUDED.retries,
+						attempts = EXCLUDED.attempts,
+						last_error = EXCLUDED.last_error,
+						retry_policy = EXCLUDED.retry_policy,
+						created_at = EXCLUDED.created_at,
+						last_attempted_at = EXCLUDED.last_attempted_at,
+						ttl = EXCLUDED.ttl,
+						headers = EXCLUDED.headers,
+						priority = EXCLUDED.priority,
+						queue = EXCLUDED.queue,
+						unique_key = EXCLUDED.unique_key,
+						failed_at = NOW();
+				`,
+				wantArgs: []interface{}{
+					"test-uid",
+					"test-job-name",
+					[]byte{0, 1, 2, 3},
+					0,
+					10,
+					"test err",
+					nullRetryPolicy{},
+					nullTime{},
+					nullTime{},
+					nullDuration{},
+					taskHeaders(nil),
+					0,
+					"",
+					sql.NullString{},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &TaskRow{
+				uid:      tt.fields.uid,
+				jobName:  tt.fields.jobName,
+				body:     tt.fields.body,
+				retries:  tt.fields.retries,
+				attempts: tt.fields.attempts,
+			}
+			act := &taskAction{
+				tx: &mockTx{
+					mockDBExecer: tt.execer,
+				},
+			}
+			if err := act.Bury(row, tt.reason); (err != nil) != tt.wantErr {
+				t.Errorf("taskActionImpl.bury() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.execer.valid {
+				t.Errorf("taskActionImpl.bury() gotStmt = %s, wantStmt = %s", tt.execer.gotStmt, tt.execer.wantStmt)
+				t.Errorf("taskActionImpl.bury() gotArgs = %v, wantArgs = %v", tt.execer.gotArgs, tt.execer.wantArgs)
+			}
+		})
+	}
+}
+
+func Test_leaseTasks(t *testing.T) {
+	queryer := &mockDBQueryer{
+		wantStmt: `
+			UPDATE jobq_tasks SET locked_by = $4, locked_until = NOW() + $5 * INTERVAL '1 millisecond',
+				attempts = attempts + 1
+			WHERE id IN (
+				SELECT id FROM jobq_tasks
+				WHERE queue = $1
+				AND job_name = ANY($2)
+				AND (timeout IS NULL OR timeout < NOW())
+				AND (start_at IS NULL OR start_at < NOW())
+				AND locked_until IS NULL
+				ORDER BY priority DESC, id ASC
+				FOR UPDATE SKIP LOCKED
+				LIMIT $3
+			) RETURNING id, uid, job_name, body, retries, attempts, timeout, start_at, retry_policy,
+				last_error, created_at, last_attempted_at, ttl, headers, priority, unique_key;
+		`,
+		wantArgs: []interface{}{
+			"test",
+			pq.Array([]string{"test-job-name"}),
+			10,
+			"worker-1",
+			int64(30000),
+		},
+		wantErr: true,
+	}
+	if _, err := leaseTasks(queryer, "test", []string{"test-job-name"}, 10, "worker-1", 30*time.Second, 0); err == nil {
+		t.Errorf("leaseTasks() error = nil, want mock err")
+	}
+	if !queryer.valid {
+		t.Errorf("leaseTasks() gotStmt = %s, wantStmt = %s", queryer.gotStmt, queryer.wantStmt)
+		t.Errorf("leaseTasks() gotArgs = %v, wantArgs = %v", queryer.gotArgs, queryer.wantArgs)
+	}
+}
+
+func Test_dequeueTasks(t *testing.T) {
+	queryer := &mockDBQueryer{
+		wantStmt: `
+			WITH claimed AS (
+				DELETE FROM jobq_tasks WHERE id IN (
+					SELECT id FROM jobq_tasks
+					WHERE queue = $1
+					AND job_name = ANY($2)
+					AND (timeout IS NULL OR timeout < NOW())
+					AND (start_at IS NULL OR start_at < NOW())
+					AND locked_until IS NULL
+					ORDER BY priority DESC, id ASC
+					FOR UPDATE SKIP LOCKED
+					LIMIT $3
+				) RETURNING id, uid, job_name, body, retries, attempts, timeout, start_at, retry_policy,
+					last_error, created_at, last_attempted_at, ttl, headers, priority, unique_key
+			)
+			SELECT id, uid, job_name, body, retries, attempts, timeout, start_at, retry_policy,
+				last_error, created_at, last_attempted_at, ttl, headers, priority, unique_key FROM claimed,
+				LATERAL (SELECT pg_advisory_xact_lock(1785684596, (id & 2147483647)::int)) l;
+		`,
+		wantArgs: []interface{}{
+			"test",
+			pq.Array([]string{"test-job-name"}),
+			10,
+		},
+		wantErr: true,
+	}
+	if _, err := dequeueTasks(queryer, "test", []string{"test-job-name"}, 10, 0); err == nil {
+		t.Errorf("dequeueTasks() error = nil, want mock err")
+	}
+	if !queryer.valid {
+		t.Errorf("dequeueTasks() gotStmt = %s, wantStmt = %s", queryer.gotStmt, queryer.wantStmt)
+		t.Errorf("dequeueTasks() gotArgs = %v, wantArgs = %v", queryer.gotArgs, queryer.wantArgs)
+	}
+}
+
+func Test_leaseAction_Rollback(t *testing.T) {
+	execer := &mockDBExecer{
+		wantStmt: `
+			UPDATE jobq_tasks SET locked_by = NULL, locked_until = NULL
+			WHERE id = ANY($1) AND locked_by = $2;
+		`,
+		wantArgs: []interface{}{
+			pq.Array([]int64{1, 2}),
+			"worker-1",
+		},
+	}
+	act := newLeaseAction(&mockDB{mockDBExecer: execer}, "worker-1", time.Minute, []*TaskRow{{id: 1}, {id: 2}})
+	go act.heartbeat()
+	if err := act.Rollback(); err != nil {
+		t.Fatalf("leaseAction.Rollback() error = %v", err)
+	}
+	if !execer.valid {
+		t.Errorf("leaseAction.Rollback() gotStmt = %s, wantStmt = %s", execer.gotStmt, execer.wantStmt)
+		t.Errorf("leaseAction.Rollback() gotArgs = %v, wantArgs = %v", execer.gotArgs, execer.wantArgs)
+	}
+	execer.gotStmt = ""
+	if err := act.Rollback(); err != nil || execer.gotStmt != "" {
+		t.Errorf("leaseAction.Rollback() released leases twice")
+	}
+}
@@ -1,5 +1,10 @@
 package jobq
 
+import (
+	"database/sql"
+	"time"
+)
+
 // PreparedTask contains details required for work
 // and is used for creating task using DBExecer
 type PreparedTask struct {
@@ -15,6 +20,11 @@ type Task struct {
 	row      *TaskRow
 	requeue  bool
 	workerID int
+	deadline *taskDeadline
+	store    Store
+	// result is stored when task of a result job succeeds
+	result    []byte
+	hasResult bool
 }
 
 // ScanBody scans tasks row body with TaskBody implementation
@@ -31,6 +41,53 @@ func (tsk *Task) UID() string {
 	return tsk.row.uid
 }
 
+// JobName returns name of a job that handles this task
+func (tsk *Task) JobName() string {
+	return tsk.row.jobName
+}
+
+// Queue returns name of a queue task was queued to
+func (tsk *Task) Queue() string {
+	return tsk.row.queue
+}
+
+// Priority returns task priority
+func (tsk *Task) Priority() int {
+	return tsk.row.priority
+}
+
+// Attempt returns number of the current attempt starting from 1
+func (tsk *Task) Attempt() int {
+	return tsk.row.attempts
+}
+
+// LastError returns error message of the previous attempt
+func (tsk *Task) LastError() string {
+	return tsk.row.lastError
+}
+
+// CreatedAt returns time when task was queued
+func (tsk *Task) CreatedAt() time.Time {
+	return tsk.row.createdAt.Time
+}
+
+// LastAttemptedAt returns time of the previous attempt.
+// Zero time is returned if this is the first attempt
+func (tsk *Task) LastAttemptedAt() time.Time {
+	return tsk.row.lastAttemptedAt.Time
+}
+
+// Header returns value of task header or
+// empty string if header is not set
+func (tsk *Task) Header(key string) string {
+	return tsk.row.headers.Get(key)
+}
+
+// Headers returns a copy of all task headers
+func (tsk *Task) Headers() map[string]string {
+	return tsk.row.headers.copy()
+}
+
 // WorkerID returns worker identifier
 func (tsk *Task) WorkerID() int {
 	return tsk.workerID
@@ -64,8 +121,12 @@ func NewTask(jobName string, body Valuer, opts ...TaskOption) (*PreparedTask, er
 	if err != nil {
 		return nil, err
 	}
+	uid := options.uid
+	if uid == "" {
+		uid = uuid()
+	}
 	task := PreparedTask{
-		uid:     uuid(),
+		uid:     uid,
 		jobName: jobName,
 		body:    body,
 		options: options,
@@ -87,18 +148,65 @@ func (pt *PreparedTask) row() (*TaskRow, error) {
 			Valid: pt.options.startAtEnabled,
 			Time:  pt.options.startAt.UTC(),
 		},
+		retryPolicy: nullRetryPolicy{
+			Policy: pt.options.retryPolicy,
+		},
+		ttl:       pt.options.nullTTL(),
+		headers:   pt.options.headers,
+		priority:  pt.options.priority,
+		queue:     pt.queue(),
+		uniqueKey: pt.uniqueKey(),
 	}, nil
 }
 
+// queue returns queue name of a task.
+// Tasks are queued to the queue of their job by default
+func (pt *PreparedTask) queue() string {
+	if pt.options.queue != "" {
+		return pt.options.queue
+	}
+	return pt.jobName
+}
+
+// uniqueKey returns unique key prefixed with it's scope,
+// so that keys of different scopes would not conflict
+func (pt *PreparedTask) uniqueKey() sql.NullString {
+	if pt.options.uniqueKey == "" {
+		return sql.NullString{}
+	}
+	var prefix string
+	switch pt.options.uniqueScope {
+	case UniqueScopeQueue:
+		prefix = "queue:" + pt.queue() + ":"
+	case UniqueScopeGlobal:
+		prefix = "global:"
+	default:
+		prefix = "job:" + pt.jobName + ":"
+	}
+	return sql.NullString{
+		Valid:  true,
+		String: prefix + pt.options.uniqueKey,
+	}
+}
+
 // Queue pushes PreparedTask to task queue
 func (pt *PreparedTask) Queue(e DBExecer) error {
 	row, err := pt.row()
 	if err != nil {
 		return err
 	}
-	return queueTask(e, row)
+	if err = queueTask(e, row); err != nil {
+		return err
+	}
+	// uid is replaced with uid of existing task with the same unique key
+	if row.uid == pt.uid && pt.options.metrics != nil {
+		pt.options.metrics.TaskEnqueued(pt.jobName, 1)
+	}
+	pt.uid = row.uid
+	return nil
 }
 
+// UID returns task uid
 func (pt *PreparedTask) UID() string {
 	return pt.uid
 }
@@ -1,7 +1,10 @@
 package jobq
 
 import (
+	"database/sql"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -126,3 +129,185 @@ func TestPreparedTask_Queue(t *testing.T) {
 		})
 	}
 }
+
+func TestTask_attempts(t *testing.T) {
+	createdAt := time.Unix(1000, 0).UTC()
+	lastAttemptedAt := time.Unix(2000, 0).UTC()
+	tsk := &Task{
+		row: &TaskRow{
+			attempts:  2,
+			lastError: "test err",
+			createdAt: nullTime{
+				Valid: true,
+				Time:  createdAt,
+			},
+			lastAttemptedAt: nullTime{
+				Valid: true,
+				Time:  lastAttemptedAt,
+			},
+		},
+	}
+	if got := tsk.Attempt(); got != 2 {
+		t.Errorf("Task.Attempt() = %v, want %v", got, 2)
+	}
+	if got := tsk.LastError(); got != "test err" {
+		t.Errorf("Task.LastError() = %v, want %v", got, "test err")
+	}
+	if got := tsk.CreatedAt(); !got.Equal(createdAt) {
+		t.Errorf("Task.CreatedAt() = %v, want %v", got, createdAt)
+	}
+	if got := tsk.LastAttemptedAt(); !got.Equal(lastAttemptedAt) {
+		t.Errorf("Task.LastAttemptedAt() = %v, want %v", got, lastAttemptedAt)
+	}
+}
+
+func TestTask_headers(t *testing.T) {
+	opts, err := defaultTaskOptions.with(
+		WithTaskHeader("tenant_id", "42"),
+		WithTaskHeader("correlation_id", "abc"),
+	)
+	if err != nil {
+		t.Fatalf("WithTaskHeader() error = %v", err)
+	}
+	tsk := &Task{
+		row: &TaskRow{
+			headers: opts.headers,
+		},
+	}
+	if got := tsk.Header("tenant_id"); got != "42" {
+		t.Errorf("Task.Header() = %v, want %v", got, "42")
+	}
+	if got := tsk.Header("missing"); got != "" {
+		t.Errorf("Task.Header() = %v, want empty", got)
+	}
+	headers := tsk.Headers()
+	want := map[string]string{"tenant_id": "42", "correlation_id": "abc"}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("Task.Headers() = %v, want %v", headers, want)
+	}
+	headers["tenant_id"] = "0"
+	if got := tsk.Header("tenant_id"); got != "42" {
+		t.Errorf("Task.Headers() returned headers of a task")
+	}
+	if _, err = defaultTaskOptions.with(WithTaskHeader("", "42")); err != ErrInvalidTaskHeader {
+		t.Errorf("WithTaskHeader() error = %v, want %v", err, ErrInvalidTaskHeader)
+	}
+}
+
+func TestPreparedTask_queue(t *testing.T) {
+	task, err := NewTask("send_email", mockValuer{})
+	if err != nil {
+		t.Fatalf("NewTask() error = %v", err)
+	}
+	if got := task.queue(); got != "send_email" {
+		t.Errorf("PreparedTask.queue() = %v, want %v", got, "send_email")
+	}
+	task, err = NewTask("send_email", mockValuer{}, WithTaskQueue("critical"))
+	if err != nil {
+		t.Fatalf("NewTask() error = %v", err)
+	}
+	if got := task.queue(); got != "critical" {
+		t.Errorf("PreparedTask.queue() = %v, want %v", got, "critical")
+	}
+}
+
+func TestPreparedTask_uniqueKey(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []TaskOption
+		want sql.NullString
+	}{
+		{
+			name: "none",
+			want: sql.NullString{},
+		},
+		{
+			name: "job",
+			opts: []TaskOption{WithTaskUniqueKey("order-1", UniqueScopeJob)},
+			want: sql.NullString{Valid: true, String: "job:send_email:order-1"},
+		},
+		{
+			name: "queue",
+			opts: []TaskOption{WithTaskQueue("critical"), WithTaskUniqueKey("order-1", UniqueScopeQueue)},
+			want: sql.NullString{Valid: true, String: "queue:critical:order-1"},
+		},
+		{
+			name: "global",
+			opts: []TaskOption{WithTaskUniqueKey("order-1", UniqueScopeGlobal)},
+			want: sql.NullString{Valid: true, String: "global:order-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, err := NewTask("send_email", mockValuer{}, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewTask() error = %v", err)
+			}
+			if got := task.uniqueKey(); got != tt.want {
+				t.Errorf("PreparedTask.uniqueKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreparedTask_Queue_uniqueKey(t *testing.T) {
+	task, err := NewTask("send_email", mockValuer{
+		onValue: func() ([]byte, error) {
+			return nil, nil
+		},
+	}, WithTaskUniqueKey("order-1", UniqueScopeJob))
+	if err != nil {
+		t.Fatalf("NewTask() error = %v", err)
+	}
+	execer := &mockDBExecer{}
+	if err = task.Queue(execer); err != nil {
+		t.Fatalf("PreparedTask.Queue() error = %v", err)
+	}
+	if !strings.Contains(execer.gotStmt, "ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING;") {
+		t.Errorf("PreparedTask.Queue() stmt = %v, want ON CONFLICT DO NOTHING", execer.gotStmt)
+	}
+	if got := execer.gotArgs[len(execer.gotArgs)-1]; got != task.uniqueKey() {
+		t.Errorf("PreparedTask.Queue() unique key = %v, want %v", got, task.uniqueKey())
+	}
+}
+
+func TestPreparedTask_Queue_metrics(t *testing.T) {
+	metrics := new(mockMetrics)
+	task, err := NewTask("send_email", mockValuer{
+		onValue: func() ([]byte, error) {
+			return nil, nil
+		},
+	}, WithTaskMetrics(metrics))
+	if err != nil {
+		t.Fatalf("NewTask() error = %v", err)
+	}
+	if err = task.Queue(&mockDBExecer{}); err != nil {
+		t.Fatalf("PreparedTask.Queue() error = %v", err)
+	}
+	if err = task.Queue(&mockDBExecer{wantErr: true}); err == nil {
+		t.Fatalf("PreparedTask.Queue() error = nil, want error")
+	}
+	if want := []string{"enqueued"}; !reflect.DeepEqual(metrics.calls, want) {
+		t.Errorf("PreparedTask.Queue() metrics = %v, want %v", metrics.calls, want)
+	}
+}
+
+func TestNewTask_uid(t *testing.T) {
+	task, err := NewTask("send_email", mockValuer{}, WithTaskUID("order-42"))
+	if err != nil {
+		t.Fatalf("NewTask() error = %v", err)
+	}
+	if got := task.UID(); got != "order-42" {
+		t.Errorf("PreparedTask.UID() = %v, want %v", got, "order-42")
+	}
+	task, err = NewTask("send_email", mockValuer{})
+	if err != nil {
+		t.Fatalf("NewTask() error = %v", err)
+	}
+	if got := task.UID(); len(got) != 36 {
+		t.Errorf("PreparedTask.UID() = %v, want random uuid", got)
+	}
+	if _, err = NewTask("send_email", mockValuer{}, WithTaskUID("")); err != ErrInvalidTaskUID {
+		t.Errorf("NewTask() error = %v, want %v", err, ErrInvalidTaskUID)
+	}
+}
@@ -0,0 +1,38 @@
+package jobq
+
+import (
+	"context"
+)
+
+// TextMapCarrier stores propagated trace context as string pairs.
+// It has the same methods as OpenTelemetry propagation.TextMapCarrier
+type TextMapCarrier interface {
+	Get(key string) string
+	Set(key, value string)
+	Keys() []string
+}
+
+// Propagator injects trace context (e.g. W3C traceparent and baggage)
+// into task headers when task is queued and extracts it when task
+// is handled. OpenTelemetry propagators can be adapted to it
+type Propagator interface {
+	Inject(ctx context.Context, carrier TextMapCarrier)
+	Extract(ctx context.Context, carrier TextMapCarrier) context.Context
+}
+
+// Tracer starts a span for each handled task. Returned function
+// ends the span with error returned by the job
+type Tracer interface {
+	StartSpan(ctx context.Context, task *Task) (context.Context, func(error))
+}
+
+// traceTask restores trace context of a task and starts it's span
+func traceTask(ctx context.Context, task *Task, propagator Propagator, tracer Tracer) (context.Context, func(error)) {
+	if propagator != nil {
+		ctx = propagator.Extract(ctx, task.row.headers)
+	}
+	if tracer == nil {
+		return ctx, func(error) {}
+	}
+	return tracer.StartSpan(ctx, task)
+}
@@ -0,0 +1,84 @@
+package jobq
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type traceKey struct{}
+
+// mockPropagator propagates string stored in context under traceKey
+type mockPropagator struct{}
+
+func (mockPropagator) Inject(ctx context.Context, carrier TextMapCarrier) {
+	if v, ok := ctx.Value(traceKey{}).(string); ok {
+		carrier.Set("traceparent", v)
+	}
+}
+
+func (mockPropagator) Extract(ctx context.Context, carrier TextMapCarrier) context.Context {
+	if v := carrier.Get("traceparent"); v != "" {
+		return context.WithValue(ctx, traceKey{}, v)
+	}
+	return ctx
+}
+
+type mockTracer struct {
+	started []string
+	ended   []error
+}
+
+func (tr *mockTracer) StartSpan(ctx context.Context, task *Task) (context.Context, func(error)) {
+	tr.started = append(tr.started, task.JobName())
+	return ctx, func(err error) {
+		tr.ended = append(tr.ended, err)
+	}
+}
+
+func Test_traceTask(t *testing.T) {
+	opts, err := defaultTaskOptions.with(WithTaskTraceContext(
+		context.WithValue(context.Background(), traceKey{}, "00-abc-def-01"),
+		mockPropagator{},
+	))
+	if err != nil {
+		t.Fatalf("WithTaskTraceContext() error = %v", err)
+	}
+	task := &Task{
+		row: &TaskRow{
+			jobName: "test",
+			headers: opts.headers,
+		},
+	}
+	tracer := new(mockTracer)
+	ctx, end := traceTask(context.Background(), task, mockPropagator{}, tracer)
+	if got := ctx.Value(traceKey{}); got != "00-abc-def-01" {
+		t.Errorf("traceTask() trace context = %v, want %v", got, "00-abc-def-01")
+	}
+	wantErr := errors.New("test err")
+	end(wantErr)
+	if len(tracer.started) != 1 || tracer.started[0] != "test" {
+		t.Errorf("traceTask() started spans = %v, want [test]", tracer.started)
+	}
+	if len(tracer.ended) != 1 || tracer.ended[0] != wantErr {
+		t.Errorf("traceTask() ended spans = %v, want [%v]", tracer.ended, wantErr)
+	}
+	ctx, end = traceTask(context.Background(), task, nil, nil)
+	end(nil)
+	if got := ctx.Value(traceKey{}); got != nil {
+		t.Errorf("traceTask() without propagator trace context = %v, want nil", got)
+	}
+}
+
+func TestWithTaskTraceContext(t *testing.T) {
+	if _, err := defaultTaskOptions.with(WithTaskTraceContext(context.Background(), nil)); err != ErrInvalidPropagator {
+		t.Errorf("WithTaskTraceContext() error = %v, want %v", err, ErrInvalidPropagator)
+	}
+	opts, err := defaultTaskOptions.with(WithTaskTraceContext(context.Background(), mockPropagator{}))
+	if err != nil || len(opts.headers) != 0 {
+		t.Errorf("WithTaskTraceContext() headers = %v, error = %v, want none", opts.headers, err)
+	}
+	if len(defaultTaskOptions.headers) != 0 {
+		t.Errorf("WithTaskTraceContext() modified default options")
+	}
+}
@@ -2,6 +2,7 @@ package jobq
 
 import (
 	"errors"
+	"math"
 	"regexp"
 	"time"
 )
@@ -11,13 +12,45 @@ var (
 	ErrJobMapUndefined        = errors.New("job map not defined")
 	ErrAlreadyRegistered      = errors.New("job already registered")
 	ErrInvalidRetries         = errors.New("retries should be >= 0")
+	ErrInvalidMaxAttempts     = errors.New("max attempts should be >= 0")
 	ErrInvalidPoolSize        = errors.New("pool size should be > 0")
 	ErrInvalidTimeout         = errors.New("timeout should be higher than 0")
+	ErrInvalidTTL             = errors.New("ttl should be at least 1ms")
 	ErrInvalidStartTime       = errors.New("start_at time should be future time")
 	ErrInvalidTaskBodyScanner = errors.New("task body scanner should not be nil")
 	ErrInvalidTaskBodyValuer  = errors.New("task body valuer should not be nil")
 	ErrInvalidJob             = errors.New("job should not be nil")
 	ErrInvalidJobName         = errors.New("invalid job name. should be snake_case")
+	ErrInvalidJobMiddleware   = errors.New("job middleware should not be nil")
+	ErrInvalidRetryPolicy     = errors.New("invalid retry policy")
+	ErrInvalidTaskRetryPolicy = errors.New("task retry policy should be one of built-in policies")
+	ErrInvalidLogger          = errors.New("logger should not be nil")
+	ErrInvalidMetrics         = errors.New("metrics recorder should not be nil")
+	ErrInvalidPropagator      = errors.New("trace propagator should not be nil")
+	ErrInvalidTracer          = errors.New("tracer should not be nil")
+	ErrInvalidTaskHeader      = errors.New("task header key should not be empty")
+	ErrInvalidPriority        = errors.New("priority should fit into 32-bit integer")
+	ErrInvalidPriorityAging   = errors.New("priority aging interval should be 0 or at least 1ms")
+	ErrInvalidQueueName       = errors.New("invalid queue name. should be snake_case")
+	ErrInvalidQueueWeight     = errors.New("queue weight should be > 0")
+	ErrQueueRegistered        = errors.New("queue already registered")
+	ErrInvalidUniqueKey       = errors.New("unique key should be 1 to 200 characters long")
+	ErrInvalidUniqueScope     = errors.New("invalid unique scope")
+	ErrInvalidTaskUID         = errors.New("task uid should be 1 to 255 characters long")
+	ErrInvalidPreparedTask    = errors.New("prepared task should not be nil")
+	ErrInvalidBatchSize       = errors.New("batch size should be 1 to 1000")
+	ErrBatchJobMiddleware     = errors.New("middlewares can not wrap batch jobs")
+	ErrInvalidLease           = errors.New("lease should be at least 1s")
+	ErrInvalidProgress        = errors.New("progress should be 0 to 100 percent")
+	ErrInvalidResultRetention = errors.New("result retention should be at least 1s")
+	ErrInvalidRetention       = errors.New("history retention should be >= 0")
+	ErrInvalidScheduleName    = errors.New("invalid schedule name. should be snake_case")
+	ErrScheduleRegistered     = errors.New("schedule already registered")
+	ErrInvalidCronSpec        = errors.New("invalid cron spec")
+	ErrInvalidTimezone        = errors.New("unknown timezone")
+	ErrInvalidBodyFactory     = errors.New("body factory should not be nil")
+	ErrInvalidCatchUpPolicy   = errors.New("invalid catch up policy")
+	ErrInvalidDrainTimeout    = errors.New("drain timeout should be >= 0")
 )
 
 const (
@@ -49,6 +82,13 @@ func validateJob(job Job) error {
 	return nil
 }
 
+func validateJobMiddleware(mw JobMiddleware) error {
+	if mw == nil {
+		return ErrInvalidJobMiddleware
+	}
+	return nil
+}
+
 func validateTaskBodyScanner(body Scanner) error {
 	if body == nil {
 		return ErrInvalidTaskBodyScanner
@@ -70,6 +110,37 @@ func validateRetries(retries int) error {
 	return nil
 }
 
+func validateMaxAttempts(attempts int) error {
+	if attempts < 0 {
+		return ErrInvalidMaxAttempts
+	}
+	return nil
+}
+
+func validateRetryPolicy(policy RetryPolicy) error {
+	if policy == nil {
+		return ErrInvalidRetryPolicy
+	}
+	p, ok := policy.(*backoffPolicy)
+	if !ok {
+		return nil
+	}
+	if p.Initial < 1 || p.Step < 0 || p.Max < 0 || p.MaxAttempts < 0 {
+		return ErrInvalidRetryPolicy
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return ErrInvalidRetryPolicy
+	}
+	return nil
+}
+
+func validateTaskRetryPolicy(policy BuiltinRetryPolicy) error {
+	if policy == nil || policy.builtin() == nil {
+		return ErrInvalidTaskRetryPolicy
+	}
+	return validateRetryPolicy(policy.builtin())
+}
+
 func validatePoolSize(size int) error {
 	if size < 1 {
 		return ErrInvalidPoolSize
@@ -84,6 +155,13 @@ func validateTimeout(timeout time.Duration) error {
 	return nil
 }
 
+func validateTTL(ttl time.Duration) error {
+	if ttl < time.Millisecond {
+		return ErrInvalidTTL
+	}
+	return nil
+}
+
 func validateStartTime(startAt time.Time) error {
 	if startAt.Before(time.Now()) {
 		return ErrInvalidStartTime
@@ -99,3 +177,173 @@ func firstError(errs ...error) error {
 	}
 	return nil
 }
+
+func validateLogger(logger Logger) error {
+	if logger == nil {
+		return ErrInvalidLogger
+	}
+	return nil
+}
+
+func validateMetrics(metrics Metrics) error {
+	if metrics == nil {
+		return ErrInvalidMetrics
+	}
+	return nil
+}
+
+func validatePropagator(p Propagator) error {
+	if p == nil {
+		return ErrInvalidPropagator
+	}
+	return nil
+}
+
+func validateTracer(tracer Tracer) error {
+	if tracer == nil {
+		return ErrInvalidTracer
+	}
+	return nil
+}
+
+func validateTaskHeader(key string) error {
+	if key == "" {
+		return ErrInvalidTaskHeader
+	}
+	return nil
+}
+
+func validatePriority(priority int) error {
+	if priority < math.MinInt32 || priority > math.MaxInt32 {
+		return ErrInvalidPriority
+	}
+	return nil
+}
+
+func validatePriorityAging(interval time.Duration) error {
+	if interval != 0 && interval < time.Millisecond {
+		return ErrInvalidPriorityAging
+	}
+	return nil
+}
+
+func validateQueueName(name string) error {
+	if validateJobName(name) != nil {
+		return ErrInvalidQueueName
+	}
+	return nil
+}
+
+func validateIfQueueUnregistered(name string, queues map[string]QueueOptions) error {
+	if _, ok := queues[name]; ok {
+		return ErrQueueRegistered
+	}
+	return nil
+}
+
+func validateQueueWeight(weight int) error {
+	if weight <= 0 {
+		return ErrInvalidQueueWeight
+	}
+	return nil
+}
+
+func validateUniqueKey(key string) error {
+	if len(key) == 0 || len(key) > 200 {
+		return ErrInvalidUniqueKey
+	}
+	return nil
+}
+
+func validateUniqueScope(scope UniqueScope) error {
+	switch scope {
+	case UniqueScopeJob, UniqueScopeQueue, UniqueScopeGlobal:
+		return nil
+	}
+	return ErrInvalidUniqueScope
+}
+
+func validateTaskUID(uid string) error {
+	if len(uid) == 0 || len(uid) > 255 {
+		return ErrInvalidTaskUID
+	}
+	return nil
+}
+
+func validatePreparedTask(task *PreparedTask) error {
+	if task == nil {
+		return ErrInvalidPreparedTask
+	}
+	return nil
+}
+
+func validateBatchSize(n int) error {
+	if n < 1 || n > maxBatchRows {
+		return ErrInvalidBatchSize
+	}
+	return nil
+}
+
+func validateLease(lease time.Duration) error {
+	if lease < time.Second {
+		return ErrInvalidLease
+	}
+	return nil
+}
+
+func validateProgress(percent float64) error {
+	if !(percent >= 0 && percent <= 100) {
+		return ErrInvalidProgress
+	}
+	return nil
+}
+
+func validateResultRetention(retention time.Duration) error {
+	if retention < time.Second {
+		return ErrInvalidResultRetention
+	}
+	return nil
+}
+
+func validateHistoryRetention(retention time.Duration) error {
+	if retention < 0 {
+		return ErrInvalidRetention
+	}
+	return nil
+}
+
+func validateScheduleName(name string) error {
+	if validateJobName(name) != nil {
+		return ErrInvalidScheduleName
+	}
+	return nil
+}
+
+func validateIfScheduleUnregistered(name string, schedules map[string]*schedule) error {
+	if _, ok := schedules[name]; ok {
+		return ErrScheduleRegistered
+	}
+	return nil
+}
+
+func validateBodyFactory(body BodyFactory) error {
+	if body == nil {
+		return ErrInvalidBodyFactory
+	}
+	return nil
+}
+
+func validateCatchUpPolicy(policy CatchUpPolicy) error {
+	switch policy {
+	case CatchUpSkip, CatchUpLatest, CatchUpAll:
+		return nil
+	}
+	return ErrInvalidCatchUpPolicy
+}
+
+func validateDrainTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return ErrInvalidDrainTimeout
+	}
+	return nil
+}
@@ -116,6 +116,34 @@ func Test_validateJob(t *testing.T) {
 	}
 }
 
+func Test_validateJobMiddleware(t *testing.T) {
+	tests := []struct {
+		name string
+		mw   JobMiddleware
+		want error
+	}{
+		{
+			name: "invalid",
+			mw:   nil,
+			want: ErrInvalidJobMiddleware,
+		},
+		{
+			name: "valid",
+			mw: func(job Job) Job {
+				return job
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateJobMiddleware(tt.mw); err != tt.want {
+				t.Errorf("validateJobMiddleware() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
 func Test_validateTaskBodyScanner(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -199,6 +227,88 @@ func Test_validateRetries(t *testing.T) {
 	}
 }
 
+func Test_validateMaxAttempts(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		want     error
+	}{
+		{
+			name:     "negative",
+			attempts: -1,
+			want:     ErrInvalidMaxAttempts,
+		},
+		{
+			name:     "positive",
+			attempts: 1,
+			want:     nil,
+		},
+		{
+			name:     "zero",
+			attempts: 0,
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMaxAttempts(tt.attempts); err != tt.want {
+				t.Errorf("validateMaxAttempts() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   error
+	}{
+		{
+			name:   "nil",
+			policy: nil,
+			want:   ErrInvalidRetryPolicy,
+		},
+		{
+			name:   "valid",
+			policy: ExponentialRetryPolicy(time.Second, time.Minute, 0.5, 5),
+			want:   nil,
+		},
+		{
+			name:   "custom",
+			policy: mockRetryPolicy{},
+			want:   nil,
+		},
+		{
+			name:   "zero_delay",
+			policy: ConstantRetryPolicy(0, 5),
+			want:   ErrInvalidRetryPolicy,
+		},
+		{
+			name:   "negative_step",
+			policy: LinearRetryPolicy(time.Second, -time.Second, 5),
+			want:   ErrInvalidRetryPolicy,
+		},
+		{
+			name:   "negative_attempts",
+			policy: FibonacciRetryPolicy(time.Second, time.Minute, -1),
+			want:   ErrInvalidRetryPolicy,
+		},
+		{
+			name:   "invalid_jitter",
+			policy: ExponentialRetryPolicy(time.Second, time.Minute, -0.5, 5),
+			want:   ErrInvalidRetryPolicy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRetryPolicy(tt.policy); err != tt.want {
+				t.Errorf("validateRetryPolicy() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
 func Test_validatePoolSize(t *testing.T) {
 	tests := []struct {
 		name string
@@ -261,6 +371,37 @@ func Test_validateTimeout(t *testing.T) {
 	}
 }
 
+func Test_validateTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want error
+	}{
+		{
+			name: "zero",
+			ttl:  0,
+			want: ErrInvalidTTL,
+		},
+		{
+			name: "too_short",
+			ttl:  time.Microsecond,
+			want: ErrInvalidTTL,
+		},
+		{
+			name: "valid",
+			ttl:  time.Minute,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTTL(tt.ttl); err != tt.want {
+				t.Errorf("validateTTL() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
 func Test_validateStartTime(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -4,14 +4,45 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"os"
+	"runtime/debug"
+	"sort"
 	"sync"
 	"time"
 )
 
 var (
 	ErrWorkCanceled = errors.New("work has been canceled")
+	ErrUnknownJob   = errors.New("task of unknown job")
 )
 
+// PanicError is returned when job panics while handling a task
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panicked: %v", e.Value)
+}
+
+// WorkerStats contains counters of tasks handled by workers
+type WorkerStats struct {
+	// Handled is a number of tasks that were handled
+	// and committed, including failed ones
+	Handled int
+	// Abandoned is a number of tasks that were rolled back
+	// because worker context was canceled
+	Abandoned int
+}
+
+func (s WorkerStats) add(other WorkerStats) WorkerStats {
+	s.Handled += other.Handled
+	s.Abandoned += other.Abandoned
+	return s
+}
+
 type Worker interface {
 	ID() int
 	IsWorking() bool
@@ -21,20 +52,85 @@ type Worker interface {
 	Pause()
 }
 
+// statsWorker is implemented by workers that count handled tasks
+type statsWorker interface {
+	Stats() WorkerStats
+}
+
+// cancelWorker is implemented by workers that cancel claimed tasks by uid
+type cancelWorker interface {
+	Cancel(uid string) bool
+}
+
+// workerJob is a job handled by queue workers.
+// Either job or batch is set
+type workerJob struct {
+	job   Job
+	batch BatchJob
+	opts  JobOptions
+}
+
+// taskBatch is a group of dequeued tasks of the same job
+type taskBatch struct {
+	job       workerJob
+	tasks     []*Task
+	startedAt time.Time
+	// succeeded, failed and dropped tasks are reported
+	// once work is committed, so that rolled back work
+	// would not be logged or recorded in metrics
+	succeeded []*Task
+	failed    []*taskFailure
+	dropped   []*Task
+	// canceled are uids of tasks canceled by Client.Cancel. cancel
+	// cancels context of a batch of one task while it is handled,
+	// tasks of batch jobs share context and are dropped after handling
+	canceled map[string]bool
+	cancel   context.CancelFunc
+	done     bool
+}
+
+// taskFailure is a failed task of a batch
+type taskFailure struct {
+	task     *Task
+	reason   error
+	duration time.Duration
+	// state is TaskQueued if task was requeued, TaskDead
+	// if it was buried and empty if it was dropped
+	state TaskState
+}
+
 type worker struct {
-	id       int
-	store    Store
-	jobName  string
-	job      Job
-	working  bool
-	awaiting bool
-	runch    chan bool
-	okch     chan bool
-	stopch   chan bool
-	opts     JobOptions
+	id            int
+	ctx           context.Context
+	store         Store
+	queue         string
+	subscriptions []QueueSubscription
+	jobs          map[string]workerJob
+	jobNames      []string
+	batchNames    []string
+	claimed       int
+	lease         time.Duration
+	owner         string
+	name          string
+	history       bool
+	handling      []*taskBatch
+	working       bool
+	awaiting      bool
+	stats         WorkerStats
+	onError       ErrorHandler
+	logger        Logger
+	metrics       Metrics
+	propagator    Propagator
+	tracer        Tracer
+	runch         chan bool
+	okch          chan bool
+	stopch        chan bool
 	sync.RWMutex
 }
 
+// WorkerFactory makes workers of a single job. Manager configures
+// queues, leases, batches and the rest of worker settings itself,
+// so this interface is kept as it was for existing implementations
 type WorkerFactory interface {
 	WithJob(name string, job Job) WorkerFactory
 	WithStore(store Store) WorkerFactory
@@ -43,45 +139,179 @@ type WorkerFactory interface {
 }
 
 type workerFactory struct {
-	n       int
-	jobName string
-	job     Job
-	store   Store
-	opts    JobOptions
+	n          int
+	ctx        context.Context
+	onError    ErrorHandler
+	logger     Logger
+	metrics    Metrics
+	propagator Propagator
+	tracer     Tracer
+	queue      string
+	subs       []QueueSubscription
+	jobs       map[string]workerJob
+	lease      time.Duration
+	history    bool
+	store      Store
+	// opts are options of jobs added with WithJob
+	opts JobOptions
 }
 
-func (f *workerFactory) WithJob(name string, job Job) WorkerFactory {
-	f.jobName = name
-	f.job = job
+// withContext sets context that is used as a parent
+// for task contexts. Canceling it cancels all running tasks
+func (f *workerFactory) withContext(ctx context.Context) *workerFactory {
+	f.ctx = ctx
 	return f
 }
 
-func (f *workerFactory) WithStore(store Store) WorkerFactory {
+// withErrorHandler sets handler for unexpected worker errors
+func (f *workerFactory) withErrorHandler(handler ErrorHandler) *workerFactory {
+	f.onError = handler
+	return f
+}
+
+// withLogger sets logger for task events
+func (f *workerFactory) withLogger(logger Logger) *workerFactory {
+	f.logger = logger
+	return f
+}
+
+// withMetrics sets task and worker metrics recorder
+func (f *workerFactory) withMetrics(metrics Metrics) *workerFactory {
+	f.metrics = metrics
+	return f
+}
+
+// withTracing sets propagator that restores trace context
+// of tasks and tracer that starts their spans
+func (f *workerFactory) withTracing(propagator Propagator, tracer Tracer) *workerFactory {
+	f.propagator = propagator
+	f.tracer = tracer
+	return f
+}
+
+// withQueue sets queue of workers and queues they take tasks from.
+// Workers take tasks from their own queue if no subscriptions are given
+func (f *workerFactory) withQueue(name string, subscriptions ...QueueSubscription) *workerFactory {
+	f.queue = name
+	f.subs = subscriptions
+	return f
+}
+
+// withJob adds a job that workers will handle
+func (f *workerFactory) withJob(name string, job Job, opts JobOptions) *workerFactory {
+	if f.jobs == nil {
+		f.jobs = make(map[string]workerJob)
+	}
+	f.jobs[name] = workerJob{
+		job:  job,
+		opts: opts,
+	}
+	return f
+}
+
+// withBatchJob adds a job that workers will handle in batches
+func (f *workerFactory) withBatchJob(name string, job BatchJob, opts JobOptions) *workerFactory {
+	if f.jobs == nil {
+		f.jobs = make(map[string]workerJob)
+	}
+	f.jobs[name] = workerJob{
+		batch: job,
+		opts:  opts,
+	}
+	return f
+}
+
+// withLease makes workers lease tasks for the given duration instead
+// of holding a transaction open while tasks are handled. Zero disables leasing
+func (f *workerFactory) withLease(lease time.Duration) *workerFactory {
+	f.lease = lease
+	return f
+}
+
+// withHistory makes workers keep finished tasks in task history
+func (f *workerFactory) withHistory(enabled bool) *workerFactory {
+	f.history = enabled
+	return f
+}
+
+func (f *workerFactory) withStore(store Store) *workerFactory {
 	f.store = store
 	return f
 }
 
+// WithJob adds a job that workers will handle with options set by WithOptions
+func (f *workerFactory) WithJob(name string, job Job) WorkerFactory {
+	if f.queue == "" {
+		f.queue = name
+	}
+	return f.withJob(name, job, f.opts)
+}
+
+func (f *workerFactory) WithStore(store Store) WorkerFactory {
+	return f.withStore(store)
+}
+
+// WithOptions sets options of jobs added with WithJob
 func (f *workerFactory) WithOptions(opts JobOptions) WorkerFactory {
 	f.opts = opts
+	for name, job := range f.jobs {
+		if job.batch == nil {
+			job.opts = opts
+			f.jobs[name] = job
+		}
+	}
 	return f
 }
 
 func NewWorkerFactory() WorkerFactory {
-	return &workerFactory{}
+	return newWorkerFactory()
+}
+
+func newWorkerFactory() *workerFactory {
+	return &workerFactory{
+		ctx:  context.Background(),
+		opts: defaultJobOptions,
+	}
 }
 
 func (f *workerFactory) Make() Worker {
 	f.n++
+	subs := f.subs
+	if len(subs) == 0 {
+		subs = []QueueSubscription{{Queue: f.queue, Weight: 1}}
+	}
+	var jobNames, batchNames []string
+	for name, job := range f.jobs {
+		if job.batch != nil && job.opts.batchSize > 1 {
+			batchNames = append(batchNames, name)
+		} else {
+			jobNames = append(jobNames, name)
+		}
+	}
+	sort.Strings(jobNames)
+	sort.Strings(batchNames)
 	return &worker{
-		id:      f.n,
-		jobName: f.jobName,
-		job:     f.job,
-		store:   f.store,
-		opts:    f.opts,
-		working: false,
-		runch:   make(chan bool),
-		okch:    make(chan bool),
-		stopch:  make(chan bool),
+		id:            f.n,
+		ctx:           f.ctx,
+		onError:       f.onError,
+		logger:        f.logger,
+		metrics:       f.metrics,
+		propagator:    f.propagator,
+		tracer:        f.tracer,
+		queue:         f.queue,
+		subscriptions: subs,
+		jobs:          f.jobs,
+		jobNames:      jobNames,
+		batchNames:    batchNames,
+		lease:         f.lease,
+		owner:         uuid(),
+		name:          workerName(f.n),
+		history:       f.history,
+		store:         f.store,
+		working:       false,
+		runch:         make(chan bool),
+		okch:          make(chan bool),
+		stopch:        make(chan bool),
 	}
 }
 
@@ -95,6 +325,13 @@ func (w *worker) IsWorking() bool {
 	return w.working
 }
 
+// Stats returns counters of tasks handled by this worker
+func (w *worker) Stats() WorkerStats {
+	w.RLock()
+	defer w.RUnlock()
+	return w.stats
+}
+
 func (w *worker) Start() {
 	for !w.isStopping() {
 		err := w.work()
@@ -111,15 +348,24 @@ func (w *worker) handleWorkErr(err error) {
 		time.Sleep(time.Millisecond * 100)
 		return
 	case ErrWorkCanceled:
-		time.Sleep(time.Second)
+		if w.context().Err() == nil {
+			time.Sleep(time.Second)
+		}
 		return
 	default:
-		fmt.Printf("unhandled err: %v\n", err)
+		w.handleError(err)
 		time.Sleep(time.Second)
 		return
 	}
 }
 
+// handleError passes err to manager error handler
+func (w *worker) handleError(err error) {
+	if w.onError != nil {
+		w.onError(fmt.Errorf("worker %d of queue %s: %w", w.id, w.queue, err))
+	}
+}
+
 func (w *worker) Stop() {
 	w.Pause()
 	w.stopch <- true
@@ -140,6 +386,100 @@ func (w *worker) Pause() {
 	w.working = false
 }
 
+// Cancel cancels claimed task with given uid and reports whether it
+// was found. Task that is not started yet is dropped before it starts
+func (w *worker) Cancel(uid string) bool {
+	w.Lock()
+	defer w.Unlock()
+	for _, b := range w.handling {
+		if b.done {
+			continue
+		}
+		for _, task := range b.tasks {
+			if task.UID() != uid {
+				continue
+			}
+			b.canceled[uid] = true
+			if b.cancel != nil && len(b.tasks) == 1 {
+				b.cancel()
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// setBatches sets claimed batches that can be canceled by Cancel
+func (w *worker) setBatches(batches []*taskBatch) {
+	w.Lock()
+	defer w.Unlock()
+	w.handling = batches
+}
+
+// markCanceled marks claimed tasks that have cancel requests
+func (w *worker) markCanceled(ids map[int64]bool) {
+	w.Lock()
+	defer w.Unlock()
+	for _, b := range w.handling {
+		for _, task := range b.tasks {
+			if ids[task.ID()] {
+				b.canceled[task.UID()] = true
+			}
+		}
+	}
+}
+
+// startBatch drops tasks canceled before batch is started
+// and returns them. Batch of one task is canceled using cancel
+func (w *worker) startBatch(b *taskBatch, cancel context.CancelFunc) []*Task {
+	w.Lock()
+	defer w.Unlock()
+	var canceled []*Task
+	tasks := b.tasks[:0]
+	for _, task := range b.tasks {
+		if b.canceled[task.UID()] {
+			canceled = append(canceled, task)
+		} else {
+			tasks = append(tasks, task)
+		}
+	}
+	b.tasks = tasks
+	b.cancel = cancel
+	return canceled
+}
+
+// takeExhausted removes leased tasks that were reaped after their
+// last attempt from the batch and returns them. Attempts of leased
+// tasks are counted when they are claimed
+func (w *worker) takeExhausted(b *taskBatch) []*Task {
+	w.Lock()
+	defer w.Unlock()
+	var exhausted []*Task
+	tasks := b.tasks[:0]
+	for _, task := range b.tasks {
+		if b.job.opts.maxAttempts > 0 && task.row.attempts > b.job.opts.maxAttempts {
+			exhausted = append(exhausted, task)
+		} else {
+			tasks = append(tasks, task)
+		}
+	}
+	b.tasks = tasks
+	return exhausted
+}
+
+// finishBatch stops accepting cancels of the batch and
+// returns uids of tasks that were canceled while handled
+func (w *worker) finishBatch(b *taskBatch) map[string]bool {
+	w.Lock()
+	defer w.Unlock()
+	b.done = true
+	canceled := make(map[string]bool, len(b.canceled))
+	for uid := range b.canceled {
+		canceled[uid] = true
+	}
+	return canceled
+}
+
 func (w *worker) isStopping() bool {
 	for !w.IsWorking() {
 		select {
@@ -156,28 +496,504 @@ func (w *worker) isStopping() bool {
 }
 
 func (w *worker) work() error {
-	act, err := w.store.Dequeue(w.jobName)
+	act, err := w.dequeue()
 	if err != nil {
 		return err
 	}
 	defer act.Rollback()
-	row := act.Row()
-	ctx, cancel := context.WithTimeout(context.Background(), w.opts.ttl)
-	defer cancel()
-	task := &Task{row, true, w.id}
-	err = w.job.HandleTask(ctx, task)
-	if err != nil && w.opts.requeuing {
-		prepareTaskForRequeue(task, w.opts)
-		err = act.Requeue(row)
+	rows := actionRows(act)
+	batches, err := w.batches(rows)
+	if err != nil {
+		return err
+	}
+	// batches are set before cancel requests are checked,
+	// so that cancels notified after the check are not missed
+	w.setBatches(batches)
+	defer w.setBatches(nil)
+	if c, ok := act.(cancelAction); ok {
+		canceled, err := c.Canceled()
 		if err != nil {
 			return err
 		}
+		w.markCanceled(canceled)
+	}
+	for _, b := range batches {
+		if err = w.handleBatch(act, b); err != nil {
+			if err == ErrWorkCanceled && w.context().Err() != nil {
+				w.count(WorkerStats{Abandoned: len(rows)})
+			}
+			return err
+		}
 	}
-	if err = ctx.Err(); err != nil {
+	if err = act.Commit(); err != nil {
+		return err
+	}
+	w.count(WorkerStats{Handled: len(rows)})
+	for _, b := range batches {
+		w.reportBatch(b)
+	}
+	return nil
+}
+
+// reportBatch logs and records outcomes of committed batch tasks
+func (w *worker) reportBatch(b *taskBatch) {
+	for _, task := range b.succeeded {
+		w.recorder().TaskSucceeded(task.JobName(), time.Since(b.startedAt))
+		w.log().Info("task succeeded", w.taskFields(task, "duration", time.Since(b.startedAt))...)
+	}
+	for _, f := range b.failed {
+		task := f.task
+		w.recorder().TaskFailed(task.JobName(), f.duration)
+		w.log().Warn("task failed", w.taskFields(task, "attempt", task.row.attempts, "error", f.reason)...)
+		switch f.state {
+		case TaskQueued:
+			fields := w.taskFields(task, "retries", task.row.retries)
+			if task.row.timeout.Valid {
+				fields = append(fields, "start_at", task.row.timeout.Time)
+			}
+			w.log().Info("task requeued", fields...)
+			w.recorder().TaskRequeued(task.JobName())
+		case TaskDead:
+			w.log().Warn("task buried", w.taskFields(task, "attempts", task.row.attempts)...)
+			w.recorder().TaskBuried(task.JobName())
+		}
+	}
+	for _, task := range b.dropped {
+		w.log().Info("task canceled", w.taskFields(task, "attempt", task.row.attempts)...)
+	}
+}
+
+// batches groups dequeued tasks by job. Tasks of batch jobs are
+// split into batches of job batch size, other tasks are handled one by one
+func (w *worker) batches(rows []*TaskRow) ([]*taskBatch, error) {
+	var batches []*taskBatch
+	open := make(map[string]*taskBatch)
+	for _, row := range rows {
+		job, ok := w.jobs[row.jobName]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownJob, row.jobName)
+		}
+		b := open[row.jobName]
+		if b == nil || job.batch == nil || len(b.tasks) >= job.opts.batchSize {
+			b = &taskBatch{job: job, canceled: make(map[string]bool)}
+			open[row.jobName] = b
+			batches = append(batches, b)
+		}
+		b.tasks = append(b.tasks, &Task{row: row, requeue: true, workerID: w.id, store: w.store})
+	}
+	return batches, nil
+}
+
+// handleBatch handles tasks of a batch and requeues or buries
+// failed ones. Batch context and span are taken from it's first task
+func (w *worker) handleBatch(act TaskAction, b *taskBatch) error {
+	b.startedAt = time.Now()
+	jobName := b.tasks[0].JobName()
+	ctx, cancel := taskContext(w.context(), b.tasks[0].row, b.job.opts)
+	defer cancel()
+	for _, task := range w.startBatch(b, cancel) {
+		if err := w.cancelTask(act, b, task); err != nil {
+			return err
+		}
+	}
+	l, leased := act.(leaseKeeper)
+	if leased {
+		for _, task := range w.takeExhausted(b) {
+			if err := w.buryExhausted(act, b, task); err != nil {
+				return err
+			}
+		}
+	}
+	if len(b.tasks) == 0 {
+		w.finishBatch(b)
+		return nil
+	}
+	first := b.tasks[0]
+	if leased {
+		l.keepWhile(ctx, cancel, w.handleError)
+	}
+	for _, task := range b.tasks {
+		task.deadline = ctx
+		if !leased {
+			task.row.attempts++
+		}
+		w.log().Debug("task dequeued", w.taskFields(task, "attempt", task.row.attempts)...)
+		w.recorder().TaskDequeued(jobName, queueDuration(task.row, b.startedAt))
+	}
+	w.recorder().WorkerBusy(w.queue, true)
+	defer w.recorder().WorkerBusy(w.queue, false)
+	spanCtx, endSpan := traceTask(ctx, first, w.propagator, w.tracer)
+	var err error
+	if b.job.batch != nil {
+		err = w.handleTasks(spanCtx, b.job.batch, b.tasks)
+	} else {
+		err = w.handleTask(spanCtx, b.job.job, first)
+	}
+	// handlers that return after ttl fail even if they return nil,
+	// since their work may have been cut short by canceled context
+	expired := ctx.Err() == context.DeadlineExceeded
+	canceled := w.finishBatch(b)
+	endSpan(err)
+	errs := batchErrors(b.tasks, err)
+	for _, task := range b.tasks {
+		reason, failed := errs[task.UID()]
+		if !failed && expired {
+			reason, failed = context.DeadlineExceeded, true
+		}
+		if canceled[task.UID()] {
+			if err = w.cancelTask(act, b, task); err != nil {
+				return err
+			}
+			continue
+		}
+		if !failed {
+			if task.hasResult {
+				if err = saveResult(act, task.row, task.result, b.job.opts.resultTTL); err != nil {
+					return err
+				}
+			}
+			if err = w.archiveTask(act, task, TaskFinished, b.startedAt); err != nil {
+				return err
+			}
+			b.succeeded = append(b.succeeded, task)
+			continue
+		}
+		task.row.lastError = reason.Error()
+		task.row.lastAttemptedAt = nullTime{
+			Valid: true,
+			Time:  b.startedAt.UTC(),
+		}
+		f := &taskFailure{task: task, reason: reason, duration: time.Since(b.startedAt)}
+		if err = w.failTask(act, f, b.job.opts); err != nil {
+			return err
+		}
+		b.failed = append(b.failed, f)
+	}
+	// tasks that ran out of ttl, including those which handlers
+	// returned nil after it, count as failed attempts and are
+	// committed, work is only abandoned when the worker is stopped
+	if w.context().Err() != nil {
 		return ErrWorkCanceled
 	}
+	return nil
+}
+
+// batchErrors returns errors of failed tasks by task uid.
+// Errors other than BatchError fail all tasks
+func batchErrors(tasks []*Task, err error) map[string]error {
+	errs := make(map[string]error)
+	if err == nil {
+		return errs
+	}
+	var batchErr BatchError
+	if errors.As(err, &batchErr) {
+		for _, task := range tasks {
+			if reason, ok := batchErr[task.UID()]; ok && reason != nil {
+				errs[task.UID()] = reason
+			}
+		}
+		return errs
+	}
+	for _, task := range tasks {
+		errs[task.UID()] = err
+	}
+	return errs
+}
+
+// dequeue takes task from subscribed queues
+// checking queues with higher weight first more often
+func (w *worker) dequeue() (TaskAction, error) {
+	claims := w.claims()
+	for _, queue := range queueOrder(w.subscriptions) {
+		for _, c := range claims {
+			act, err := w.claim(queue, c)
+			if err == ErrEmptyQueue {
+				continue
+			}
+			return act, err
+		}
+	}
+	return nil, ErrEmptyQueue
+}
+
+// taskClaim is a group of jobs which tasks are claimed together
+type taskClaim struct {
+	jobNames []string
+	limit    int
+}
+
+// claim takes tasks of the queue either by leasing them
+// or by deleting them in a transaction held until commit
+func (w *worker) claim(queue string, c taskClaim) (TaskAction, error) {
+	if w.lease > 0 {
+		l, ok := w.store.(leaseStore)
+		if !ok {
+			return nil, fmt.Errorf("lease tasks: %w", ErrNotSupported)
+		}
+		return l.Lease(queue, c.jobNames, c.limit, w.owner, w.lease)
+	}
+	return w.store.Dequeue(queue, c.jobNames, c.limit)
+}
+
+// claims returns claim of each batch job with up to batch size tasks
+// and a claim of a single task of other jobs. Claims are rotated,
+// so that batch jobs would not starve other jobs of the queue
+func (w *worker) claims() []taskClaim {
+	claims := make([]taskClaim, 0, len(w.batchNames)+1)
+	for _, name := range w.batchNames {
+		claims = append(claims, taskClaim{
+			jobNames: []string{name},
+			limit:    w.jobs[name].opts.batchSize,
+		})
+	}
+	if len(w.jobNames) > 0 || len(claims) == 0 {
+		claims = append(claims, taskClaim{jobNames: w.jobNames, limit: 1})
+	}
+	at := w.claimed % len(claims)
+	w.claimed++
+	return append(append([]taskClaim(nil), claims[at:]...), claims[:at]...)
+}
+
+// queueOrder returns subscribed queues in weighted random order
+func queueOrder(subs []QueueSubscription) []string {
+	subs = append([]QueueSubscription(nil), subs...)
+	queues := make([]string, 0, len(subs))
+	for len(subs) > 0 {
+		total := 0
+		for _, sub := range subs {
+			total += sub.Weight
+		}
+		n := rand.Intn(total)
+		at := 0
+		for i, sub := range subs {
+			if n < sub.Weight {
+				at = i
+				break
+			}
+			n -= sub.Weight
+		}
+		queues = append(queues, subs[at].Queue)
+		subs = append(subs[:at], subs[at+1:]...)
+	}
+	return queues
+}
+
+// log returns worker logger or
+// discards events if logger is not set
+func (w *worker) log() Logger {
+	if w.logger == nil {
+		return nopLogger{}
+	}
+	return w.logger
+}
+
+// recorder returns worker metrics recorder or
+// discards metrics if recorder is not set
+func (w *worker) recorder() Metrics {
+	if w.metrics == nil {
+		return nopMetrics{}
+	}
+	return w.metrics
+}
+
+// taskFields returns structured logging fields of a task
+func (w *worker) taskFields(task *Task, args ...interface{}) []interface{} {
+	fields := []interface{}{
+		"job", task.JobName(),
+		"queue", task.Queue(),
+		"task_uid", task.UID(),
+		"worker_id", w.id,
+	}
+	return append(fields, args...)
+}
+
+// context returns worker context which is
+// canceled when worker has to abandon it's task
+func (w *worker) context() context.Context {
+	if w.ctx == nil {
+		return context.Background()
+	}
+	return w.ctx
+}
+
+func (w *worker) count(stats WorkerStats) {
+	w.Lock()
+	defer w.Unlock()
+	w.stats = w.stats.add(stats)
+}
+
+// queueDuration returns how long task has been in task queue
+func queueDuration(row *TaskRow, dequeuedAt time.Time) time.Duration {
+	if !row.createdAt.Valid || dequeuedAt.Before(row.createdAt.Time) {
+		return 0
+	}
+	return dequeuedAt.Sub(row.createdAt.Time)
+}
+
+// taskContext returns context that is canceled after task ttl.
+// Task ttl overrides job ttl and zero task ttl disables deadline
+func taskContext(parent context.Context, row *TaskRow, opts JobOptions) (*taskDeadline, context.CancelFunc) {
+	if row.ttl.Valid {
+		return newTaskDeadline(parent, row.ttl.Duration)
+	}
+	if !opts.ttlEnabled {
+		return newTaskDeadline(parent, 0)
+	}
+	return newTaskDeadline(parent, opts.ttl)
+}
+
+// handleTask calls job and recovers from panic,
+// so that it could be handled as a failed task
+func (w *worker) handleTask(ctx context.Context, job Job, task *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+	return job.HandleTask(ctx, task)
+}
+
+// handleTasks calls batch job and recovers from panic,
+// so that it could be handled as a failed batch
+func (w *worker) handleTasks(ctx context.Context, job BatchJob, tasks []*Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+	return job.HandleTasks(ctx, tasks)
+}
+
+// failTask requeues failed task or moves it to dead tasks
+// if it has no more attempts left
+func (w *worker) failTask(act TaskAction, f *taskFailure, opts JobOptions) error {
+	task := f.task
+	if isTaskDead(task, opts) {
+		return w.buryTask(act, f)
+	}
+	if !opts.requeuing {
+		// task is deleted on commit, so it's kept in history as failed
+		return w.archiveTask(act, task, TaskFailed, task.row.lastAttemptedAt.Time)
+	}
+	policy := taskRetryPolicy(task, opts)
+	if policy == nil {
+		prepareTaskForRequeue(task, opts)
+		return w.requeueTask(act, f)
+	}
+	next, ok := policy.NextRetry(task.row.attempts, f.reason)
+	if !ok {
+		return w.buryTask(act, f)
+	}
+	task.row.timeout = nullTime{
+		Valid: true,
+		Time:  next.UTC(),
+	}
+	return w.requeueTask(act, f)
+}
+
+func (w *worker) requeueTask(act TaskAction, f *taskFailure) error {
+	if err := act.Requeue(f.task.row); err != nil {
+		return err
+	}
+	f.state = TaskQueued
+	return nil
+}
+
+func (w *worker) buryTask(act TaskAction, f *taskFailure) error {
+	task := f.task
+	bury, ok := act.(buryAction)
+	if !ok {
+		return fmt.Errorf("bury task: %w", ErrNotSupported)
+	}
+	if err := bury.Bury(task.row, f.reason); err != nil {
+		return err
+	}
+	if err := w.archiveTask(act, task, TaskDead, task.row.lastAttemptedAt.Time); err != nil {
+		return err
+	}
+	f.state = TaskDead
+	return nil
+}
+
+// buryExhausted buries leased task that was reaped after it's last
+// attempt, so that tasks crashing their workers would not loop forever
+func (w *worker) buryExhausted(act TaskAction, b *taskBatch, task *Task) error {
+	// attempt counted by the claim is not made
+	task.row.attempts--
+	task.row.lastError = ErrLeaseLost.Error()
+	task.row.lastAttemptedAt = nullTime{
+		Valid: true,
+		Time:  b.startedAt.UTC(),
+	}
+	f := &taskFailure{task: task, reason: ErrLeaseLost}
+	if err := w.buryTask(act, f); err != nil {
+		return err
+	}
+	b.failed = append(b.failed, f)
+	return nil
+}
+
+// cancelTask drops task canceled by Client.Cancel
+// and keeps it in task history as canceled
+func (w *worker) cancelTask(act TaskAction, b *taskBatch, task *Task) error {
+	// tasks are only marked canceled by cancel actions
+	if err := act.(cancelAction).Cancel(task.row, w.name, time.Since(b.startedAt)); err != nil {
+		return err
+	}
+	b.dropped = append(b.dropped, task)
+	return nil
+}
+
+// archiveTask keeps finished task in task history if it is enabled
+func (w *worker) archiveTask(act TaskAction, task *Task, status TaskState, startedAt time.Time) error {
+	if !w.history {
+		return nil
+	}
+	archive, ok := act.(archiveAction)
+	if !ok {
+		return fmt.Errorf("archive task: %w", ErrNotSupported)
+	}
+	return archive.Archive(task.row, status, w.name, time.Since(startedAt))
+}
+
+// saveResult stores result of a result job task
+func saveResult(act TaskAction, row *TaskRow, result []byte, retention time.Duration) error {
+	r, ok := act.(resultAction)
+	if !ok {
+		return fmt.Errorf("save result: %w", ErrNotSupported)
+	}
+	return r.SaveResult(row, result, retention)
+}
+
+// workerName returns name of a worker that
+// identifies it's process in task history
+func workerName(id int) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d/%d", host, os.Getpid(), id)
+}
+
+// taskRetryPolicy returns task retry policy if it was set
+// and falls back to job retry policy
+func taskRetryPolicy(task *Task, opts JobOptions) RetryPolicy {
+	if task.row.retryPolicy.Policy != nil {
+		return task.row.retryPolicy.Policy
+	}
+	return opts.retryPolicy
+}
 
-	return act.Commit()
+// isTaskDead reports whether failed task
+// has exhausted all of it's attempts
+func isTaskDead(task *Task, opts JobOptions) bool {
+	return opts.maxAttempts > 0 && task.row.attempts >= opts.maxAttempts
 }
 
 func prepareTaskForRequeue(task *Task, opts JobOptions) {
@@ -19,6 +19,10 @@ type workerPool struct {
 }
 
 func NewWorkerPool(factory WorkerFactory) WorkerPool {
+	return newWorkerPool(factory)
+}
+
+func newWorkerPool(factory WorkerFactory) *workerPool {
 	return &workerPool{
 		factory: factory,
 		workers: []Worker{},
@@ -68,6 +72,29 @@ func (wp *workerPool) Start() {
 	}
 }
 
+// Stats returns sum of counters of workers that count handled tasks
+func (wp *workerPool) Stats() WorkerStats {
+	wp.RLock()
+	defer wp.RUnlock()
+	stats := WorkerStats{}
+	for _, w := range wp.workers {
+		if sw, ok := w.(statsWorker); ok {
+			stats = stats.add(sw.Stats())
+		}
+	}
+	return stats
+}
+
+// Pause stops all workers from taking new tasks.
+// Tasks that are already running are not affected
+func (wp *workerPool) Pause() {
+	wp.RLock()
+	defer wp.RUnlock()
+	for _, w := range wp.workers {
+		w.Pause()
+	}
+}
+
 func (wp *workerPool) Stop() {
 	wp.RLock()
 	defer wp.RUnlock()
@@ -76,6 +103,19 @@ func (wp *workerPool) Stop() {
 	}
 }
 
+// Cancel cancels task that is handled by one of the workers
+// and reports whether task was found
+func (wp *workerPool) Cancel(uid string) bool {
+	wp.RLock()
+	defer wp.RUnlock()
+	for _, w := range wp.workers {
+		if cw, ok := w.(cancelWorker); ok && cw.Cancel(uid) {
+			return true
+		}
+	}
+	return false
+}
+
 func (wp *workerPool) increase() {
 	w := wp.factory.Make()
 	go w.Start()
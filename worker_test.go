@@ -3,10 +3,24 @@ package jobq
 import (
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
 	"testing"
 	"time"
 )
 
+var testSubscriptions = []QueueSubscription{{Queue: "test", Weight: 1}}
+
+// testJobs returns jobs of a worker that handles a single job
+func testJobs(name string, job Job, opts JobOptions) map[string]workerJob {
+	return map[string]workerJob{
+		name: {
+			job:  job,
+			opts: opts,
+		},
+	}
+}
+
 func Test_worker_isWorking(t *testing.T) {
 	type fields struct {
 		working bool
@@ -196,7 +210,7 @@ func Test_worker_start(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return &mockTaskAction{
 							taskRow: &TaskRow{
 								id:      1,
@@ -232,7 +246,7 @@ func Test_worker_start(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return &mockTaskAction{
 							taskRow: &TaskRow{
 								id:      1,
@@ -258,12 +272,12 @@ func Test_worker_start(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			w := &worker{
-				working: tt.fields.working,
-				runch:   tt.fields.runch,
-				stopch:  tt.fields.stopch,
-				store:   tt.fields.store,
-				jobName: tt.fields.jobName,
-				job:     tt.fields.job,
+				working:       tt.fields.working,
+				runch:         tt.fields.runch,
+				stopch:        tt.fields.stopch,
+				store:         tt.fields.store,
+				subscriptions: testSubscriptions,
+				jobs:          testJobs(tt.fields.jobName, tt.fields.job, JobOptions{}),
 			}
 			if tt.before != nil {
 				go tt.before(w)
@@ -281,10 +295,13 @@ func Test_worker_work(t *testing.T) {
 		working bool
 		opts    JobOptions
 	}
+	expired := map[int64]bool{}
+	expiredNil := map[int64]bool{}
 	tests := []struct {
-		name    string
-		fields  fields
-		wantErr bool
+		name       string
+		fields     fields
+		wantErr    bool
+		wantBuried map[int64]bool
 	}{
 		{
 			name: "success",
@@ -296,7 +313,7 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return &mockTaskAction{
 							taskRow: &TaskRow{
 								id:      1,
@@ -327,7 +344,7 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return nil, errors.New("test err")
 					},
 				},
@@ -345,7 +362,7 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return nil, ErrEmptyQueue
 					},
 				},
@@ -364,8 +381,9 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return &mockTaskAction{
+							buriedIDs: expiredNil,
 							taskRow: &TaskRow{
 								id:      1,
 								body:    nil,
@@ -382,10 +400,54 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				opts: JobOptions{
-					ttl: time.Millisecond * 100,
+					ttlEnabled:  true,
+					ttl:         time.Millisecond * 100,
+					requeuing:   true,
+					maxAttempts: 1,
 				},
 			},
-			wantErr: true,
+			wantErr:    false,
+			wantBuried: expiredNil,
+		},
+		{
+			name: "bury_expired",
+			fields: fields{
+				jobName: "test",
+				job: &mockJob{
+					onHandleTask: func(ctx context.Context, _ *Task) error {
+						<-ctx.Done()
+						return ctx.Err()
+					},
+				},
+				store: &mockStore{
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+						return &mockTaskAction{
+							buriedIDs: expired,
+							taskRow: &TaskRow{
+								id:       1,
+								body:     nil,
+								jobName:  "test",
+								retries:  5,
+								attempts: 2,
+								startAt: nullTime{
+									Valid: false,
+								},
+								timeout: nullTime{
+									Valid: false,
+								},
+							},
+						}, nil
+					},
+				},
+				opts: JobOptions{
+					ttlEnabled:  true,
+					ttl:         time.Millisecond * 10,
+					requeuing:   true,
+					maxAttempts: 3,
+				},
+			},
+			wantErr:    false,
+			wantBuried: expired,
 		},
 		{
 			name: "requeue_with_retries",
@@ -397,7 +459,7 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return &mockTaskAction{
 							taskRow: &TaskRow{
 								id:      1,
@@ -415,8 +477,9 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				opts: JobOptions{
-					ttl:       time.Millisecond * 100,
-					requeuing: true,
+					ttlEnabled: true,
+					ttl:        time.Millisecond * 100,
+					requeuing:  true,
 				},
 			},
 			wantErr: false,
@@ -431,7 +494,7 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return &mockTaskAction{
 							taskRow: &TaskRow{
 								id:      1,
@@ -449,6 +512,7 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				opts: JobOptions{
+					ttlEnabled:     true,
 					ttl:            time.Millisecond * 100,
 					requeuing:      true,
 					timeout:        time.Minute,
@@ -458,6 +522,116 @@ func Test_worker_work(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "requeue_on_panic",
+			fields: fields{
+				jobName: "test",
+				job: &mockJob{
+					onHandleTask: func(context.Context, *Task) error {
+						panic("test panic")
+					},
+				},
+				store: &mockStore{
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+						return &mockTaskAction{
+							taskRow: &TaskRow{
+								id:      1,
+								body:    nil,
+								jobName: "test",
+								retries: 5,
+								startAt: nullTime{
+									Valid: false,
+								},
+								timeout: nullTime{
+									Valid: false,
+								},
+							},
+						}, nil
+					},
+				},
+				opts: JobOptions{
+					ttlEnabled: true,
+					ttl:        time.Millisecond * 100,
+					requeuing:  true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "bury_dead",
+			fields: fields{
+				jobName: "test",
+				job: &mockJob{
+					onHandleTask: func(context.Context, *Task) error {
+						return errors.New("test err")
+					},
+				},
+				store: &mockStore{
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+						return &mockTaskAction{
+							taskRow: &TaskRow{
+								id:       1,
+								body:     nil,
+								jobName:  "test",
+								retries:  5,
+								attempts: 2,
+								startAt: nullTime{
+									Valid: false,
+								},
+								timeout: nullTime{
+									Valid: false,
+								},
+							},
+						}, nil
+					},
+				},
+				opts: JobOptions{
+					ttlEnabled:  true,
+					ttl:         time.Millisecond * 100,
+					requeuing:   true,
+					maxAttempts: 3,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "bury_fails",
+			fields: fields{
+				jobName: "test",
+				job: &mockJob{
+					onHandleTask: func(context.Context, *Task) error {
+						return errors.New("test err")
+					},
+				},
+				store: &mockStore{
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+						return &mockTaskAction{
+							taskRow: &TaskRow{
+								id:       1,
+								body:     nil,
+								jobName:  "test",
+								retries:  5,
+								attempts: 2,
+								startAt: nullTime{
+									Valid: false,
+								},
+								timeout: nullTime{
+									Valid: false,
+								},
+							},
+							errBury: errors.New("bury test err"),
+						}, nil
+					},
+				},
+				opts: JobOptions{
+					ttlEnabled:  true,
+					ttl:         time.Millisecond * 100,
+					requeuing:   true,
+					maxAttempts: 3,
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "requeue_fails",
 			fields: fields{
@@ -468,7 +642,7 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				store: &mockStore{
-					onDequeue: func(name string) (TaskAction, error) {
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
 						return &mockTaskAction{
 							taskRow: &TaskRow{
 								id:      1,
@@ -487,8 +661,9 @@ func Test_worker_work(t *testing.T) {
 					},
 				},
 				opts: JobOptions{
-					ttl:       time.Millisecond * 100,
-					requeuing: true,
+					ttlEnabled: true,
+					ttl:        time.Millisecond * 100,
+					requeuing:  true,
 				},
 			},
 			wantErr: true,
@@ -497,15 +672,564 @@ func Test_worker_work(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			w := &worker{
-				store:   tt.fields.store,
-				jobName: tt.fields.jobName,
-				job:     tt.fields.job,
-				working: tt.fields.working,
-				opts:    tt.fields.opts,
+				store:         tt.fields.store,
+				subscriptions: testSubscriptions,
+				jobs:          testJobs(tt.fields.jobName, tt.fields.job, tt.fields.opts),
+				working:       tt.fields.working,
 			}
 			if err := w.work(); (err != nil) != tt.wantErr {
 				t.Errorf("worker.work() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.wantBuried != nil && !tt.wantBuried[1] {
+				t.Errorf("worker.work() task was not buried")
+			}
+		})
+	}
+}
+
+func Test_queueDuration(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		createdAt nullTime
+		want      time.Duration
+	}{
+		{
+			name: "unknown",
+			want: 0,
+		},
+		{
+			name:      "queued",
+			createdAt: nullTime{Valid: true, Time: now.Add(-time.Second)},
+			want:      time.Second,
+		},
+		{
+			name:      "clock_skew",
+			createdAt: nullTime{Valid: true, Time: now.Add(time.Second)},
+			want:      0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &TaskRow{createdAt: tt.createdAt}
+			if got := queueDuration(row, now); got != tt.want {
+				t.Errorf("queueDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_taskContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		ttl          nullDuration
+		opts         JobOptions
+		wantDeadline bool
+		wantTTL      time.Duration
+	}{
+		{
+			name: "job_ttl",
+			opts: JobOptions{
+				ttlEnabled: true,
+				ttl:        time.Minute,
+			},
+			wantDeadline: true,
+			wantTTL:      time.Minute,
+		},
+		{
+			name: "job_ttl_disabled",
+			opts: JobOptions{
+				ttlEnabled: false,
+				ttl:        time.Minute,
+			},
+			wantDeadline: false,
+		},
+		{
+			name: "task_ttl",
+			ttl: nullDuration{
+				Valid:    true,
+				Duration: time.Hour,
+			},
+			opts: JobOptions{
+				ttlEnabled: true,
+				ttl:        time.Minute,
+			},
+			wantDeadline: true,
+			wantTTL:      time.Hour,
+		},
+		{
+			name: "task_ttl_disabled",
+			ttl: nullDuration{
+				Valid: true,
+			},
+			opts: JobOptions{
+				ttlEnabled: true,
+				ttl:        time.Minute,
+			},
+			wantDeadline: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &TaskRow{
+				ttl: tt.ttl,
+			}
+			before := time.Now()
+			ctx, cancel := taskContext(context.Background(), row, tt.opts)
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			if ok != tt.wantDeadline {
+				t.Fatalf("taskContext() has deadline = %v, want %v", ok, tt.wantDeadline)
+			}
+			if ok && (deadline.Before(before.Add(tt.wantTTL)) || deadline.After(time.Now().Add(tt.wantTTL))) {
+				t.Errorf("taskContext() deadline = %v, want after %v", deadline, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func Test_worker_handleTask(t *testing.T) {
+	tests := []struct {
+		name      string
+		job       Job
+		wantErr   error
+		wantPanic bool
+	}{
+		{
+			name: "success",
+			job: &mockJob{
+				onHandleTask: func(context.Context, *Task) error {
+					return nil
+				},
+			},
+		},
+		{
+			name: "error",
+			job: &mockJob{
+				onHandleTask: func(context.Context, *Task) error {
+					return ErrWorkCanceled
+				},
+			},
+			wantErr: ErrWorkCanceled,
+		},
+		{
+			name: "panic",
+			job: &mockJob{
+				onHandleTask: func(context.Context, *Task) error {
+					panic("test panic")
+				},
+			},
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &worker{}
+			err := w.handleTask(context.Background(), tt.job, &Task{})
+			if !tt.wantPanic {
+				if err != tt.wantErr {
+					t.Errorf("worker.handleTask() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			perr, ok := err.(*PanicError)
+			if !ok {
+				t.Fatalf("worker.handleTask() error = %v, want *PanicError", err)
+			}
+			if perr.Value != "test panic" {
+				t.Errorf("worker.handleTask() PanicError.Value = %v, want %v", perr.Value, "test panic")
+			}
+			if len(perr.Stack) == 0 {
+				t.Error("worker.handleTask() PanicError.Stack is empty")
+			}
+		})
+	}
+}
+
+func Test_worker_work_recordsAttempt(t *testing.T) {
+	row := &TaskRow{
+		id:       1,
+		jobName:  "test",
+		retries:  5,
+		attempts: 1,
+	}
+	job := &mockJob{
+		onHandleTask: func(ctx context.Context, tsk *Task) error {
+			if tsk.Attempt() != 2 {
+				t.Errorf("Task.Attempt() = %v, want %v", tsk.Attempt(), 2)
+			}
+			return errors.New("test err")
+		},
+	}
+	w := &worker{
+		subscriptions: testSubscriptions,
+		jobs: testJobs("test", job, JobOptions{
+			ttlEnabled: true,
+			ttl:        time.Millisecond * 100,
+			requeuing:  true,
+		}),
+		store: &mockStore{
+			onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+				return &mockTaskAction{
+					taskRow: row,
+				}, nil
+			},
+		},
+	}
+	before := time.Now().UTC()
+	if err := w.work(); err != nil {
+		t.Fatalf("worker.work() error = %v", err)
+	}
+	if row.attempts != 2 {
+		t.Errorf("worker.work() row.attempts = %v, want %v", row.attempts, 2)
+	}
+	if row.lastError != "test err" {
+		t.Errorf("worker.work() row.lastError = %v, want %v", row.lastError, "test err")
+	}
+	if !row.lastAttemptedAt.Valid || row.lastAttemptedAt.Time.Before(before) {
+		t.Errorf("worker.work() row.lastAttemptedAt = %v, want after %v", row.lastAttemptedAt, before)
+	}
+}
+
+func Test_worker_work_stats(t *testing.T) {
+	tests := []struct {
+		name      string
+		canceled  bool
+		wantErr   error
+		wantStats WorkerStats
+	}{
+		{
+			name:    "handled",
+			wantErr: nil,
+			wantStats: WorkerStats{
+				Handled: 1,
+			},
+		},
+		{
+			name:     "abandoned",
+			canceled: true,
+			wantErr:  ErrWorkCanceled,
+			wantStats: WorkerStats{
+				Abandoned: 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			job := &mockJob{
+				onHandleTask: func(context.Context, *Task) error {
+					if tt.canceled {
+						cancel()
+					}
+					return nil
+				},
+			}
+			w := &worker{
+				ctx:           ctx,
+				subscriptions: testSubscriptions,
+				jobs: testJobs("test", job, JobOptions{
+					ttlEnabled: true,
+					ttl:        time.Minute,
+				}),
+				store: &mockStore{
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+						return &mockTaskAction{
+							taskRow: &TaskRow{
+								id:      1,
+								jobName: "test",
+							},
+						}, nil
+					},
+				},
+			}
+			if err := w.work(); err != tt.wantErr {
+				t.Errorf("worker.work() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := w.Stats(); got != tt.wantStats {
+				t.Errorf("worker.Stats() = %v, want %v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+func Test_worker_work_events(t *testing.T) {
+	errCommit := errors.New("commit err")
+	tests := []struct {
+		name        string
+		handleErr   error
+		errCommit   error
+		opts        JobOptions
+		wantErr     error
+		wantEvents  []string
+		wantMetrics []string
+	}{
+		{
+			name: "succeeded",
+			opts: JobOptions{
+				ttlEnabled: true,
+				ttl:        time.Minute,
+			},
+			wantEvents:  []string{"task dequeued", "task succeeded"},
+			wantMetrics: []string{"dequeued", "succeeded"},
+		},
+		{
+			name:      "requeued",
+			handleErr: errors.New("test err"),
+			opts: JobOptions{
+				ttlEnabled: true,
+				ttl:        time.Minute,
+				requeuing:  true,
+			},
+			wantEvents:  []string{"task dequeued", "task failed", "task requeued"},
+			wantMetrics: []string{"dequeued", "failed", "requeued"},
+		},
+		{
+			name:      "buried",
+			handleErr: errors.New("test err"),
+			opts: JobOptions{
+				ttlEnabled:  true,
+				ttl:         time.Minute,
+				requeuing:   true,
+				maxAttempts: 1,
+			},
+			wantEvents:  []string{"task dequeued", "task failed", "task buried"},
+			wantMetrics: []string{"dequeued", "failed", "buried"},
+		},
+		{
+			name:      "rolled_back",
+			handleErr: errors.New("test err"),
+			errCommit: errCommit,
+			opts: JobOptions{
+				ttlEnabled: true,
+				ttl:        time.Minute,
+				requeuing:  true,
+			},
+			wantErr:     errCommit,
+			wantEvents:  []string{"task dequeued"},
+			wantMetrics: []string{"dequeued"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := new(mockLogger)
+			metrics := new(mockMetrics)
+			job := &mockJob{
+				onHandleTask: func(context.Context, *Task) error {
+					return tt.handleErr
+				},
+			}
+			w := &worker{
+				id:            3,
+				logger:        logger,
+				metrics:       metrics,
+				subscriptions: testSubscriptions,
+				jobs:          testJobs("test", job, tt.opts),
+				store: &mockStore{
+					onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+						return &mockTaskAction{
+							errCommit: tt.errCommit,
+							taskRow: &TaskRow{
+								id:      1,
+								uid:     "uid",
+								jobName: "test",
+								queue:   "test",
+							},
+						}, nil
+					},
+				},
+			}
+			if err := w.work(); err != tt.wantErr {
+				t.Fatalf("worker.work() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(logger.events, tt.wantEvents) {
+				t.Errorf("worker.work() logged %v, want %v", logger.events, tt.wantEvents)
+			}
+			if !reflect.DeepEqual(metrics.calls, tt.wantMetrics) {
+				t.Errorf("worker.work() recorded %v, want %v", metrics.calls, tt.wantMetrics)
+			}
+			if metrics.busy != 0 {
+				t.Errorf("worker.work() busy workers = %v, want 0", metrics.busy)
+			}
+			for i, fields := range logger.fields {
+				want := []interface{}{"job", "test", "queue", "test", "task_uid", "uid", "worker_id", 3}
+				if len(fields) < len(want) || !reflect.DeepEqual(fields[:len(want)], want) {
+					t.Errorf("worker.work() %q fields = %v, want prefix %v", logger.events[i], fields, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_worker_failTask(t *testing.T) {
+	errRequeued := errors.New("requeued")
+	errBuried := errors.New("buried")
+	errArchived := errors.New("archived")
+	tests := []struct {
+		name        string
+		opts        JobOptions
+		history     bool
+		attempts    int
+		taskPolicy  *backoffPolicy
+		want        error
+		wantTimeout bool
+	}{
+		{
+			name: "requeue",
+			opts: JobOptions{
+				requeuing: true,
+				retries:   5,
+			},
+			attempts: 1,
+			want:     errRequeued,
+		},
+		{
+			name: "requeuing_disabled",
+			opts: JobOptions{
+				requeuing: false,
+			},
+			attempts: 1,
+			want:     nil,
+		},
+		{
+			name: "requeuing_disabled_history",
+			opts: JobOptions{
+				requeuing: false,
+			},
+			history:  true,
+			attempts: 1,
+			want:     errArchived,
+		},
+		{
+			name: "max_attempts",
+			opts: JobOptions{
+				requeuing:   true,
+				maxAttempts: 3,
+			},
+			attempts: 3,
+			want:     errBuried,
+		},
+		{
+			name: "job_policy_retry",
+			opts: JobOptions{
+				requeuing:   true,
+				retryPolicy: ConstantRetryPolicy(time.Minute, 3),
+			},
+			attempts:    2,
+			want:        errRequeued,
+			wantTimeout: true,
+		},
+		{
+			name: "job_policy_give_up",
+			opts: JobOptions{
+				requeuing:   true,
+				retryPolicy: ConstantRetryPolicy(time.Minute, 3),
+			},
+			attempts: 3,
+			want:     errBuried,
+		},
+		{
+			name: "task_policy_overrides",
+			opts: JobOptions{
+				requeuing:   true,
+				retryPolicy: ConstantRetryPolicy(time.Minute, 3),
+			},
+			attempts:    3,
+			taskPolicy:  ConstantRetryPolicy(time.Minute, 10).(*backoffPolicy),
+			want:        errRequeued,
+			wantTimeout: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &worker{history: tt.history}
+			task := &Task{
+				row: &TaskRow{
+					attempts: tt.attempts,
+					retries:  5,
+					retryPolicy: nullRetryPolicy{
+						Policy: tt.taskPolicy,
+					},
+				},
+			}
+			act := &mockTaskAction{
+				errRequeue: errRequeued,
+				errBury:    errBuried,
+				errArchive: errArchived,
+			}
+			f := &taskFailure{task: task, reason: errors.New("test err")}
+			if err := w.failTask(act, f, tt.opts); err != tt.want {
+				t.Errorf("worker.failTask() error = %v, want %v", err, tt.want)
+			}
+			if tt.wantTimeout && !task.row.timeout.Time.After(time.Now()) {
+				t.Errorf("worker.failTask() timeout = %v, want future time", task.row.timeout.Time)
+			}
+		})
+	}
+}
+
+func Test_worker_handleWorkErr_onError(t *testing.T) {
+	var got error
+	w := &worker{
+		id:      7,
+		queue:   "test",
+		working: true,
+		onError: func(err error) {
+			got = err
+		},
+	}
+	want := errors.New("test err")
+	w.handleWorkErr(want)
+	if !errors.Is(got, want) {
+		t.Errorf("worker.handleWorkErr() handled err = %v, want %v", got, want)
+	}
+	got = nil
+	w.handleWorkErr(ErrEmptyQueue)
+	if got != nil {
+		t.Errorf("worker.handleWorkErr() handled err = %v, want nil", got)
+	}
+}
+
+func Test_isTaskDead(t *testing.T) {
+	tests := []struct {
+		name        string
+		attempts    int
+		maxAttempts int
+		want        bool
+	}{
+		{
+			name:        "unlimited",
+			attempts:    100,
+			maxAttempts: 0,
+			want:        false,
+		},
+		{
+			name:        "below_max",
+			attempts:    2,
+			maxAttempts: 3,
+			want:        false,
+		},
+		{
+			name:        "reached_max",
+			attempts:    3,
+			maxAttempts: 3,
+			want:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &Task{
+				row: &TaskRow{
+					attempts: tt.attempts,
+				},
+			}
+			opts := JobOptions{
+				maxAttempts: tt.maxAttempts,
+			}
+			if got := isTaskDead(task, opts); got != tt.want {
+				t.Errorf("isTaskDead() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -554,3 +1278,491 @@ func Test_worker_handleWorkErr(t *testing.T) {
 		})
 	}
 }
+
+func Test_queueOrder(t *testing.T) {
+	subs := []QueueSubscription{
+		{Queue: "critical", Weight: 9},
+		{Queue: "bulk", Weight: 1},
+	}
+	first := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		got := queueOrder(subs)
+		if len(got) != 2 || got[0] == got[1] {
+			t.Fatalf("queueOrder() = %v, want both queues once", got)
+		}
+		first[got[0]]++
+	}
+	if first["critical"] <= first["bulk"] {
+		t.Errorf("queueOrder() first queues = %v, want critical more often", first)
+	}
+	if subs[0].Queue != "critical" || subs[1].Queue != "bulk" {
+		t.Errorf("queueOrder() modified subscriptions = %v", subs)
+	}
+}
+
+func Test_worker_dequeue(t *testing.T) {
+	var dequeued []string
+	w := &worker{
+		subscriptions: []QueueSubscription{
+			{Queue: "critical", Weight: 1},
+			{Queue: "bulk", Weight: 1},
+		},
+		jobNames: []string{"test"},
+		store: &mockStore{
+			onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+				dequeued = append(dequeued, queue)
+				if queue == "bulk" {
+					return &mockTaskAction{
+						taskRow: &TaskRow{queue: queue},
+					}, nil
+				}
+				return nil, ErrEmptyQueue
+			},
+		},
+	}
+	act, err := w.dequeue()
+	if err != nil {
+		t.Fatalf("worker.dequeue() error = %v", err)
+	}
+	if act.Row().queue != "bulk" {
+		t.Errorf("worker.dequeue() queue = %v, want %v", act.Row().queue, "bulk")
+	}
+	w.subscriptions = w.subscriptions[:1]
+	dequeued = nil
+	if _, err = w.dequeue(); err != ErrEmptyQueue {
+		t.Errorf("worker.dequeue() error = %v, want %v", err, ErrEmptyQueue)
+	}
+	if !reflect.DeepEqual(dequeued, []string{"critical"}) {
+		t.Errorf("worker.dequeue() checked queues = %v, want [critical]", dequeued)
+	}
+}
+
+func Test_worker_work_unknownJob(t *testing.T) {
+	w := &worker{
+		subscriptions: testSubscriptions,
+		jobs:          testJobs("test", &mockJob{}, JobOptions{}),
+		store: &mockStore{
+			onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+				return &mockTaskAction{
+					taskRow: &TaskRow{jobName: "other"},
+				}, nil
+			},
+		},
+	}
+	if err := w.work(); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("worker.work() error = %v, want %v", err, ErrUnknownJob)
+	}
+}
+
+func Test_worker_work_batch(t *testing.T) {
+	errTask := errors.New("test err")
+	var batches [][]string
+	var handled []string
+	batch := BatchJobFunc(func(ctx context.Context, tasks []*Task) error {
+		uids := make([]string, 0, len(tasks))
+		for _, task := range tasks {
+			uids = append(uids, task.UID())
+		}
+		batches = append(batches, uids)
+		return BatchError{"b2": errTask}
+	})
+	job := &mockJob{
+		onHandleTask: func(ctx context.Context, task *Task) error {
+			handled = append(handled, task.UID())
+			return nil
+		},
+	}
+	batchRows := []*TaskRow{
+		{uid: "b1", jobName: "batch"},
+		{uid: "b2", jobName: "batch"},
+		{uid: "b3", jobName: "batch"},
+		{uid: "b4", jobName: "batch"},
+	}
+	otherRows := []*TaskRow{{uid: "o1", jobName: "other"}}
+	rows := append(append([]*TaskRow(nil), batchRows...), otherRows...)
+	gotLimits := make(map[string]int)
+	f := &workerFactory{}
+	f.withBatchJob("batch", batch, JobOptions{batchSize: 3, requeuing: true})
+	f.withJob("other", job, JobOptions{})
+	f.withQueue("test")
+	f.withStore(&mockStore{
+		onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+			if len(jobNames) != 1 {
+				t.Fatalf("worker.work() dequeued jobs = %v, want one job", jobNames)
+			}
+			gotLimits[jobNames[0]] = limit
+			if jobNames[0] == "batch" {
+				return &mockTaskAction{taskRows: batchRows}, nil
+			}
+			return &mockTaskAction{taskRows: otherRows}, nil
+		},
+	})
+	w := f.Make().(*worker)
+	for i := 0; i < 2; i++ {
+		if err := w.work(); err != nil {
+			t.Fatalf("worker.work() error = %v", err)
+		}
+	}
+	if !reflect.DeepEqual(gotLimits, map[string]int{"batch": 3, "other": 1}) {
+		t.Errorf("worker.work() dequeue limits = %v, want batch: 3, other: 1", gotLimits)
+	}
+	wantBatches := [][]string{{"b1", "b2", "b3"}, {"b4"}}
+	if !reflect.DeepEqual(batches, wantBatches) {
+		t.Errorf("worker.work() batches = %v, want %v", batches, wantBatches)
+	}
+	if !reflect.DeepEqual(handled, []string{"o1"}) {
+		t.Errorf("worker.work() handled = %v, want [o1]", handled)
+	}
+	for _, row := range rows {
+		wantErr := ""
+		if row.uid == "b2" {
+			wantErr = errTask.Error()
+		}
+		if row.lastError != wantErr {
+			t.Errorf("worker.work() task %s last error = %q, want %q", row.uid, row.lastError, wantErr)
+		}
+		if row.attempts != 1 {
+			t.Errorf("worker.work() task %s attempts = %v, want 1", row.uid, row.attempts)
+		}
+	}
+	if got := w.Stats(); got.Handled != len(rows) {
+		t.Errorf("worker.Stats() handled = %v, want %v", got.Handled, len(rows))
+	}
+}
+
+func Test_batchErrors(t *testing.T) {
+	errTask := errors.New("test err")
+	tasks := []*Task{
+		{row: &TaskRow{uid: "a"}},
+		{row: &TaskRow{uid: "b"}},
+	}
+	tests := []struct {
+		name string
+		err  error
+		want map[string]error
+	}{
+		{
+			name: "success",
+			want: map[string]error{},
+		},
+		{
+			name: "all_failed",
+			err:  errTask,
+			want: map[string]error{"a": errTask, "b": errTask},
+		},
+		{
+			name: "batch_error",
+			err:  BatchError{"b": errTask, "c": errTask, "a": nil},
+			want: map[string]error{"b": errTask},
+		},
+		{
+			name: "wrapped_batch_error",
+			err:  fmt.Errorf("wrapped: %w", BatchError{"a": errTask}),
+			want: map[string]error{"a": errTask},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchErrors(tasks, tt.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batchErrors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWorkerFactory(t *testing.T) {
+	job := &mockJob{}
+	opts := JobOptions{requeuing: true, retries: 3}
+	store := &mockStore{}
+	w := NewWorkerFactory().
+		WithJob("send_email", job).
+		WithStore(store).
+		WithOptions(opts).
+		Make().(*worker)
+	if w.queue != "send_email" {
+		t.Errorf("WorkerFactory.Make() queue = %v, want send_email", w.queue)
+	}
+	if got := w.jobs["send_email"]; got.job != job || !reflect.DeepEqual(got.opts, opts) {
+		t.Errorf("WorkerFactory.Make() job = %v, opts = %v, want %v, %v", got.job, got.opts, job, opts)
+	}
+	if w.store != store {
+		t.Errorf("WorkerFactory.Make() store = %v, want %v", w.store, store)
+	}
+}
+
+func Test_worker_claim(t *testing.T) {
+	var leased, dequeued bool
+	store := &mockStore{
+		onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+			dequeued = true
+			return nil, ErrEmptyQueue
+		},
+		onLease: func(queue string, jobNames []string, limit int, owner string, lease time.Duration) (TaskAction, error) {
+			leased = owner == "worker-1" && lease == time.Minute
+			return nil, ErrEmptyQueue
+		},
+	}
+	w := &worker{
+		subscriptions: testSubscriptions,
+		store:         store,
+		owner:         "worker-1",
+	}
+	w.claim("test", taskClaim{limit: 1})
+	if !dequeued || leased {
+		t.Errorf("worker.claim() without lease dequeued = %v, leased = %v", dequeued, leased)
+	}
+	dequeued = false
+	w.lease = time.Minute
+	w.claim("test", taskClaim{limit: 1})
+	if dequeued || !leased {
+		t.Errorf("worker.claim() with lease dequeued = %v, leased = %v", dequeued, leased)
+	}
+}
+
+// mockLeaseAction is a task action of leased tasks
+type mockLeaseAction struct {
+	mockTaskAction
+}
+
+func (mockLeaseAction) keepWhile(context.Context, context.CancelFunc, func(error)) {}
+
+func Test_worker_work_lease(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempts     int
+		wantHandled  bool
+		wantAttempts int
+		wantBuried   bool
+	}{
+		{
+			name:         "counted_by_claim",
+			attempts:     2,
+			wantHandled:  true,
+			wantAttempts: 2,
+		},
+		{
+			name:         "reaped_after_last_attempt",
+			attempts:     4,
+			wantHandled:  false,
+			wantAttempts: 3,
+			wantBuried:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := false
+			buried := map[int64]bool{}
+			// attempts of leased task include the current one
+			row := &TaskRow{id: 1, uid: "uid", jobName: "test", queue: "test", attempts: tt.attempts}
+			job := &mockJob{
+				onHandleTask: func(context.Context, *Task) error {
+					handled = true
+					return nil
+				},
+			}
+			w := &worker{
+				subscriptions: testSubscriptions,
+				jobs:          testJobs("test", job, JobOptions{requeuing: true, maxAttempts: 3}),
+				lease:         time.Minute,
+				store: &mockStore{
+					onLease: func(queue string, jobNames []string, limit int, owner string, lease time.Duration) (TaskAction, error) {
+						return &mockLeaseAction{mockTaskAction{taskRow: row, buriedIDs: buried}}, nil
+					},
+				},
+			}
+			if err := w.work(); err != nil {
+				t.Fatalf("worker.work() error = %v", err)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("worker.work() handled = %v, want %v", handled, tt.wantHandled)
+			}
+			if row.attempts != tt.wantAttempts {
+				t.Errorf("worker.work() attempts = %v, want %v", row.attempts, tt.wantAttempts)
+			}
+			if buried[1] != tt.wantBuried {
+				t.Errorf("worker.work() buried = %v, want %v", buried[1], tt.wantBuried)
+			}
+		})
+	}
+}
+
+func Test_worker_archiveTask(t *testing.T) {
+	errArchived := errors.New("archived")
+	tests := []struct {
+		name    string
+		history bool
+		want    error
+	}{
+		{
+			name:    "enabled",
+			history: true,
+			want:    errArchived,
+		},
+		{
+			name:    "disabled",
+			history: false,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &worker{history: tt.history}
+			task := &Task{row: &TaskRow{}}
+			act := &mockTaskAction{errArchive: errArchived}
+			if err := w.archiveTask(act, task, TaskFinished, time.Now()); err != tt.want {
+				t.Errorf("worker.archiveTask() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_worker_Cancel(t *testing.T) {
+	var w *worker
+	var found, other bool
+	job := &mockJob{
+		onHandleTask: func(ctx context.Context, task *Task) error {
+			other = w.Cancel("other")
+			found = w.Cancel(task.UID())
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	row := &TaskRow{uid: "test", jobName: "test"}
+	f := &workerFactory{}
+	f.withJob("test", job, JobOptions{requeuing: true})
+	f.withQueue("test")
+	f.withStore(&mockStore{
+		onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+			return &mockTaskAction{
+				taskRows:   []*TaskRow{row},
+				errRequeue: errors.New("requeued"),
+			}, nil
+		},
+	})
+	w = f.Make().(*worker)
+	if err := w.work(); err != nil {
+		t.Fatalf("worker.work() error = %v", err)
+	}
+	if !found || other {
+		t.Errorf("worker.Cancel() found = %v, other = %v, want true, false", found, other)
+	}
+	if row.lastError != "" {
+		t.Errorf("worker.work() last error = %q, want empty", row.lastError)
+	}
+	if w.Cancel("test") {
+		t.Error("worker.Cancel() = true after task was handled, want false")
+	}
+}
+
+func Test_worker_Cancel_beforeStart(t *testing.T) {
+	var handled []string
+	job := &mockJob{
+		onHandleTask: func(ctx context.Context, task *Task) error {
+			handled = append(handled, task.UID())
+			return nil
+		},
+	}
+	errCancel := errors.New("canceled")
+	f := &workerFactory{}
+	f.withJob("test", job, JobOptions{})
+	f.withQueue("test")
+	f.withStore(&mockStore{
+		onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+			return &mockTaskAction{
+				taskRows:    []*TaskRow{{id: 1, uid: "test", jobName: "test"}},
+				canceledIDs: map[int64]bool{1: true},
+				errCancel:   errCancel,
+			}, nil
+		},
+	})
+	w := f.Make().(*worker)
+	if err := w.work(); err != errCancel {
+		t.Errorf("worker.work() error = %v, want %v", err, errCancel)
+	}
+	if len(handled) != 0 {
+		t.Errorf("worker.work() handled canceled tasks %v", handled)
+	}
+}
+
+func Test_worker_Cancel_batch(t *testing.T) {
+	var w *worker
+	var ctxErr error
+	batch := BatchJobFunc(func(ctx context.Context, tasks []*Task) error {
+		if !w.Cancel("b1") {
+			t.Errorf("worker.Cancel() = false for a task of running batch")
+		}
+		ctxErr = ctx.Err()
+		return nil
+	})
+	errCancel := errors.New("canceled")
+	f := &workerFactory{}
+	f.withBatchJob("batch", batch, JobOptions{batchSize: 2})
+	f.withQueue("test")
+	f.withStore(&mockStore{
+		onDequeue: func(queue string, jobNames []string, limit int) (TaskAction, error) {
+			return &mockTaskAction{
+				taskRows: []*TaskRow{
+					{id: 1, uid: "b1", jobName: "batch"},
+					{id: 2, uid: "b2", jobName: "batch"},
+				},
+				errCancel: errCancel,
+			}, nil
+		},
+	})
+	w = f.Make().(*worker)
+	if err := w.work(); err != errCancel {
+		t.Errorf("worker.work() error = %v, want %v", err, errCancel)
+	}
+	if ctxErr != nil {
+		t.Errorf("batch context error = %v after one task was canceled, want nil", ctxErr)
+	}
+}
+
+// basicStore implements only methods of Store
+type basicStore struct {
+	act TaskAction
+}
+
+func (s basicStore) Dequeue(queue string, jobNames []string, limit int) (TaskAction, error) {
+	return s.act, nil
+}
+
+func (s basicStore) Queue(row *TaskRow) error {
+	return nil
+}
+
+// basicTaskAction implements only methods of TaskAction
+type basicTaskAction struct {
+	row *TaskRow
+}
+
+func (act basicTaskAction) Commit() error          { return nil }
+func (act basicTaskAction) Rollback() error        { return nil }
+func (act basicTaskAction) Requeue(*TaskRow) error { return nil }
+func (act basicTaskAction) Row() *TaskRow          { return act.row }
+
+func Test_worker_work_basicStore(t *testing.T) {
+	var progressErr error
+	job := &mockJob{
+		onHandleTask: func(_ context.Context, task *Task) error {
+			progressErr = task.ReportProgress(50, "half")
+			return nil
+		},
+	}
+	row := &TaskRow{id: 1, uid: "uid", jobName: "test", queue: "test"}
+	w := &worker{
+		subscriptions: testSubscriptions,
+		jobs:          testJobs("test", job, JobOptions{}),
+		store:         basicStore{act: basicTaskAction{row: row}},
+	}
+	if err := w.work(); err != nil {
+		t.Fatalf("worker.work() error = %v", err)
+	}
+	if progressErr != ErrNotSupported {
+		t.Errorf("Task.ReportProgress() error = %v, want %v", progressErr, ErrNotSupported)
+	}
+	w.lease = time.Minute
+	if err := w.work(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("worker.work() with lease error = %v, want %v", err, ErrNotSupported)
+	}
+}